@@ -45,31 +45,58 @@ func (arg StringArg) WriteDoc(w io.Writer) {
 
 // RepeatingArg is a repeating argument. It can be empty when not required,
 // or must occur one or more times when required.
+//
+// Min and Max bound the number of occurrences. A zero Max means there is no
+// upper bound, and a positive Min implies the argument is required.
 type RepeatingArg struct {
 	Label     string    // Label is for documentation purposes.
 	Required  bool      // Required means one or more occurrences must happen.
+	Min       int       // Min is the minimum number of occurrences.
+	Max       int       // Max is the maximum number of occurrences.
 	Recipient *[]string // Recipient is the pointer that will receive the parsed args.
 }
 
 // AppendTo appends the argument as the last one in the list.
 func (arg RepeatingArg) AppendTo(a *ArgList) {
-	a.Append(arg.Label, (*listValue)(arg.Recipient), arg.Required, true)
+	a.AppendRepeating(arg.Label, (*listValue)(arg.Recipient), arg.min(), arg.Max)
 }
 
 // WriteDoc writes the argument's instruction to w.
 func (arg RepeatingArg) WriteDoc(w io.Writer) {
 	fmt.Fprintf(w, " ")
-	if !arg.Required {
+	min := arg.min()
+	if min == 0 {
 		fmt.Fprintf(w, "[%s ...]", arg.Label)
+	} else {
+		fmt.Fprintf(w, "<%s> [...]", arg.Label)
+	}
+	if min <= 1 && arg.Max == 0 {
 		return
 	}
-	fmt.Fprintf(w, "<%s> [...]", arg.Label)
+	// Counts other than the usual ones are written as a quantifier.
+	fmt.Fprint(w, "{")
+	if min > 0 {
+		fmt.Fprint(w, min)
+	}
+	fmt.Fprint(w, ",")
+	if arg.Max > 0 {
+		fmt.Fprint(w, arg.Max)
+	}
+	fmt.Fprint(w, "}")
+}
+
+func (arg RepeatingArg) min() int {
+	if arg.Required && arg.Min < 1 {
+		return 1
+	}
+	return arg.Min
 }
 
 type argument struct {
 	name     string
 	required bool
 	repeat   bool
+	min, max int
 	value    ArgValue
 }
 
@@ -88,31 +115,70 @@ func (a *ArgList) Append(name string, v ArgValue, required, repeat bool) {
 	})
 }
 
-func (a *ArgList) missing(args []string) *argument {
-	var (
-		stk     = a.args
-		current int
-	)
-	for current = 0; current < len(args) && current < len(a.args); current++ {
-	}
-	stk = stk[current:]
-	args = args[current:]
-	for i, arg := range stk {
-		if !arg.required {
-			return nil
+// AppendRepeating appends a repeating argument that must occur at least min times
+// and at most max times to itself. A zero max means there is no upper bound.
+func (a *ArgList) AppendRepeating(name string, v ArgValue, min, max int) {
+	a.args = append(a.args, argument{
+		name:     name,
+		required: min > 0,
+		repeat:   true,
+		min:      min,
+		max:      max,
+		value:    v,
+	})
+}
+
+// check returns an error when args don't satisfy the list's requirements,
+// that is, when required arguments are missing or a repeating argument
+// occurs more or less times than it should.
+func (a *ArgList) check(args []string) error {
+	for i, arg := range a.args {
+		n := len(args) - i // how many args are left for this one
+		if arg.repeat {
+			if n < 0 {
+				n = 0
+			}
+			switch {
+			case n == 0 && arg.required:
+				return fmt.Errorf("missing required argument: %s", arg.name)
+			case n < arg.min:
+				return fmt.Errorf("not enough arguments for %s: want at least %d, got %d", arg.name, arg.min, n)
+			case arg.max > 0 && n > arg.max:
+				return fmt.Errorf("too many arguments for %s: want at most %d, got %d", arg.name, arg.max, n)
+			}
+			return nil // if arg repeats, there are no more args to check
 		}
-		count := i + 1
-		if count > len(args) {
-			return &stk[i]
+		if n > 0 {
+			continue
 		}
-		if arg.repeat { // if arg repeats, next repeating args are optional
+		if !arg.required {
 			return nil
 		}
+		return fmt.Errorf("missing required argument: %s", arg.name)
 	}
 	return nil
 }
 
+// surplus returns the args that are left over after all arguments are consumed.
+func (a *ArgList) surplus(args []string) []string {
+	n := len(a.args)
+	if n > 0 && a.args[n-1].repeat {
+		return nil // repeating args consume everything
+	}
+	if len(args) <= n {
+		return nil
+	}
+	return args[n:]
+}
+
+// parse sets args to the list's values. Values of this package are reset beforehand,
+// so that values from a previous run don't leak into arguments that are not provided.
 func (a *ArgList) parse(args []string) error {
+	for _, arg := range a.args {
+		if r, ok := arg.value.(interface{ reset() }); ok {
+			r.reset()
+		}
+	}
 	for i := 0; i < len(args) && i < len(a.args); i++ {
 		arg := a.args[i]
 		if arg.repeat {
@@ -138,9 +204,13 @@ func (sv *strValue) Set(v []string) error {
 	return nil
 }
 
+func (sv *strValue) reset() { *sv = "" }
+
 type listValue []string
 
 func (lv *listValue) Set(v []string) error {
 	*lv = listValue(v)
 	return nil
 }
+
+func (lv *listValue) reset() { *lv = nil }
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Executor is implemented by command structs passed to Build,
+// whose Exec method becomes the command's Exec function.
+type Executor interface {
+	Exec(Program) error
+}
+
+// Build builds a command out of v, which must be a pointer to a struct,
+// by reading tags of the struct's fields.
+//
+// Options are defined by the "opt" tag, which holds the option's name. Option fields
+// must be of type bool, string, int, int64 or implement flag.Value through a pointer.
+// They are configured by the following tags:
+//
+//   short:"x"        sets the option's short name
+//   aliases:"a,b"    sets the option's extra long names, separated by commas
+//   desc:"..."       sets the option's description
+//   default:"..."    sets the option's default value
+//   env:"NAME"       sets the environment variable that overrides the default value
+//   label:"..."      sets the label of the option's argument
+//   group:"..."      sets the group the option is listed under in the help message
+//   hidden:"true"    hides the option from the help message
+//   deprecated:"..." marks the option as deprecated, with an optional message
+//   negatable:"true" defines a "no-" prefixed flag for a bool option
+//   count:"true"     makes an int option count how many times it is used
+//   max:"N"          sets the maximum count of a counting option
+//
+// Positional arguments are defined by the "arg" tag, which holds the argument's position,
+// starting at zero. Argument fields must be of type string or []string, the latter being
+// a repeating argument, which must come last. They are configured by the following tags:
+//
+//   label:"..."      sets the argument's label, which defaults to the field's name in uppercase
+//   required:"true"  makes the argument required
+//   repeating:"true" documents the argument as repeating, which is implied by []string
+//
+// Subcommands are defined by the "cmd" tag, which holds the subcommand's name.
+// Subcommand fields must be either structs or pointers to structs, which are built
+// recursively and can have a description set by the "desc" tag and a category set by
+// the "category" tag. Subcommands can also be hidden from the help message by the
+// "hidden" tag and marked as deprecated by the "deprecated" tag. The "defaultcmd" tag set to
+// true makes the subcommand the one run when no subcommand is given.
+//
+// Options and subcommands are declared in the same order as their fields.
+// When v implements Executor, its Exec method is set as the command's Exec.
+//
+// The built command is bound to v, whose fields receive values while parsing and whose
+// default values are set only once, by Build. So, in order to run a CLI more than once
+// or concurrently, the command must be built per run by using NewFunc:
+//
+//   cli.NewFunc(func() *cli.Command { return cli.MustBuild(new(Root)) })
+func Build(v interface{}) (*Command, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cli: cannot build command from %T, want a non-nil pointer to a struct", v)
+	}
+	return build(rv)
+}
+
+// MustBuild is just like Build but panics if v can't be built.
+func MustBuild(v interface{}) *Command {
+	c, err := Build(v)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func build(rv reflect.Value) (*Command, error) {
+	var (
+		c    Command
+		args []reflect.StructField
+		st   = rv.Elem().Type()
+	)
+	if e, ok := rv.Interface().(Executor); ok {
+		c.Exec = e.Exec
+	}
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := rv.Elem().Field(i)
+		opt, isOpt := sf.Tag.Lookup("opt")
+		_, isArg := sf.Tag.Lookup("arg")
+		cmd, isCmd := sf.Tag.Lookup("cmd")
+		if !isOpt && !isArg && !isCmd {
+			continue
+		}
+		if sf.PkgPath != "" {
+			return nil, fmt.Errorf("cli: field %s is unexported", sf.Name)
+		}
+		var err error
+		switch {
+		case isOpt:
+			var o Option
+			o, err = buildOption(sf, fv)
+			c.OrderedOptions = append(c.OrderedOptions, NamedOption{opt, o})
+		case isArg:
+			args = append(args, sf)
+		case isCmd:
+			var sub *Command
+			if sub, err = buildSubcommand(sf, fv); err != nil {
+				break
+			}
+			c.OrderedSubcommands = append(c.OrderedSubcommands, NamedCommand{cmd, sub})
+			var isDefault bool
+			if isDefault, err = boolTag(sf, "defaultcmd"); isDefault {
+				c.DefaultSubcommand = cmd
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	arg, err := buildArg(rv, args)
+	if err != nil {
+		return nil, err
+	}
+	c.Arg = arg
+	return &c, nil
+}
+
+func buildOption(sf reflect.StructField, fv reflect.Value) (Option, error) {
+	details := OptionDetails{
+		Description: sf.Tag.Get("desc"),
+		ArgLabel:    sf.Tag.Get("label"),
+		Env:         sf.Tag.Get("env"),
+		Group:       sf.Tag.Get("group"),
+	}
+	if aliases := sf.Tag.Get("aliases"); aliases != "" {
+		details.Aliases = strings.Split(aliases, ",")
+	}
+	hidden, err := boolTag(sf, "hidden")
+	if err != nil {
+		return nil, err
+	}
+	details.Hidden = hidden
+	if msg, ok := sf.Tag.Lookup("deprecated"); ok {
+		details.Deprecated = &Deprecation{Message: msg}
+	}
+	if short := sf.Tag.Get("short"); short != "" {
+		r, size := utf8.DecodeRuneInString(short)
+		if size != len(short) || r == utf8.RuneError {
+			return nil, fmt.Errorf("cli: field %s: short name must be a single character, got %q", sf.Name, short)
+		}
+		details.Short = r
+	}
+	def, hasDef := sf.Tag.Lookup("default")
+	if v, ok := fv.Addr().Interface().(flag.Value); ok {
+		if hasDef {
+			if err := v.Set(def); err != nil {
+				return nil, fmt.Errorf("cli: field %s: bad default value: %w", sf.Name, err)
+			}
+		}
+		return VarOption{OptionDetails: details, Recipient: v}, nil
+	}
+	switch p := fv.Addr().Interface().(type) {
+	case *bool:
+		o := BoolOption{OptionDetails: details, Recipient: p}
+		if o.Negatable, err = boolTag(sf, "negatable"); err != nil {
+			return nil, err
+		}
+		if hasDef {
+			o.DefValue, err = strconv.ParseBool(def)
+		}
+		return o, wrapDefErr(sf, err)
+	case *string:
+		return StringOption{OptionDetails: details, Recipient: p, DefValue: def}, nil
+	case *int:
+		var n int64
+		if hasDef {
+			n, err = strconv.ParseInt(def, 0, strconv.IntSize)
+			if err != nil {
+				return nil, wrapDefErr(sf, err)
+			}
+		}
+		count, err := boolTag(sf, "count")
+		if err != nil {
+			return nil, err
+		}
+		if !count {
+			return IntOption{OptionDetails: details, DefValue: int(n), Recipient: p}, nil
+		}
+		o := CountOption{OptionDetails: details, DefValue: int(n), Recipient: p}
+		if maxTag, ok := sf.Tag.Lookup("max"); ok {
+			if o.Max, err = strconv.Atoi(maxTag); err != nil {
+				return nil, fmt.Errorf("cli: field %s: bad max value: %w", sf.Name, err)
+			}
+		}
+		return o, nil
+	case *int64:
+		o := Int64Option{OptionDetails: details, Recipient: p}
+		if hasDef {
+			o.DefValue, err = strconv.ParseInt(def, 0, 64)
+		}
+		return o, wrapDefErr(sf, err)
+	}
+	return nil, fmt.Errorf("cli: field %s: unsupported option type %s", sf.Name, sf.Type)
+}
+
+func boolTag(sf reflect.StructField, key string) (bool, error) {
+	s, ok := sf.Tag.Lookup(key)
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("cli: field %s: bad %s value: %w", sf.Name, key, err)
+	}
+	return b, nil
+}
+
+func wrapDefErr(sf reflect.StructField, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("cli: field %s: bad default value: %w", sf.Name, err)
+}
+
+func buildSubcommand(sf reflect.StructField, fv reflect.Value) (*Command, error) {
+	switch {
+	case fv.Kind() == reflect.Struct:
+		fv = fv.Addr()
+	case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+	default:
+		return nil, fmt.Errorf("cli: field %s: unsupported command type %s", sf.Name, sf.Type)
+	}
+	c, err := build(fv)
+	if err != nil {
+		return nil, err
+	}
+	c.Description = sf.Tag.Get("desc")
+	c.Category = sf.Tag.Get("category")
+	if c.Hidden, err = boolTag(sf, "hidden"); err != nil {
+		return nil, err
+	}
+	if msg, ok := sf.Tag.Lookup("deprecated"); ok {
+		c.Deprecated = &Deprecation{Message: msg}
+	}
+	return c, nil
+}
+
+func buildArg(rv reflect.Value, fields []reflect.StructField) (Arg, error) {
+	byPos := make([]*reflect.StructField, len(fields))
+	for i := range fields {
+		sf := &fields[i]
+		pos, err := strconv.Atoi(sf.Tag.Get("arg"))
+		if err != nil || pos < 0 || pos >= len(fields) {
+			return nil, fmt.Errorf("cli: field %s: bad argument position %q", sf.Name, sf.Tag.Get("arg"))
+		}
+		if byPos[pos] != nil {
+			return nil, fmt.Errorf("cli: fields %s and %s: same argument position %d", byPos[pos].Name, sf.Name, pos)
+		}
+		byPos[pos] = sf
+	}
+	// Arguments are chained backwards, since each one holds the next.
+	var next Arg
+	for pos := len(byPos) - 1; pos >= 0; pos-- {
+		sf := byPos[pos]
+		label := sf.Tag.Get("label")
+		if label == "" {
+			label = strings.ToUpper(sf.Name)
+		}
+		required, err := boolTag(*sf, "required")
+		if err != nil {
+			return nil, err
+		}
+		repeating, err := boolTag(*sf, "repeating")
+		if err != nil {
+			return nil, err
+		}
+		switch p := rv.Elem().FieldByIndex(sf.Index).Addr().Interface().(type) {
+		case *string:
+			if repeating {
+				return nil, fmt.Errorf("cli: field %s: repeating argument must be of type []string", sf.Name)
+			}
+			next = StringArg{Label: label, Required: required, Recipient: p, Next: next}
+		case *[]string:
+			if next != nil {
+				return nil, fmt.Errorf("cli: field %s: repeating argument must come last", sf.Name)
+			}
+			next = RepeatingArg{Label: label, Required: required, Recipient: p}
+		default:
+			return nil, fmt.Errorf("cli: field %s: unsupported argument type %s", sf.Name, sf.Type)
+		}
+	}
+	return next, nil
+}
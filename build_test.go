@@ -0,0 +1,192 @@
+package cli_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gbrlsnchs/cli"
+	"github.com/gbrlsnchs/cli/cliutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+type buildRoot struct {
+	Verbose bool       `opt:"verbose" short:"v" desc:"be verbose"`
+	Push    *buildPush `cmd:"push" desc:"push refs to a remote"`
+	Remote  struct {
+		Add buildRemoteAdd `cmd:"add"`
+	} `cmd:"remote" desc:"manage remotes" category:"setup" defaultcmd:"true"`
+}
+
+type buildPush struct {
+	Force   bool                       `opt:"force" short:"f" desc:"force the push"`
+	Retries int                        `opt:"retries" default:"3" env:"RETRIES" label:"N" desc:"retry N times" group:"network"`
+	Timeout int64                      `opt:"timeout" default:"0x10" desc:"time out after some seconds" group:"network"`
+	Message string                     `opt:"message" aliases:"msg" default:"hello" desc:"set a message"`
+	Modes   cliutil.CommaSepOptionList `opt:"modes" default:"foo,bar" desc:"set modes"`
+	Remote  string                     `arg:"0" required:"true"`
+	Refs    []string                   `arg:"1" label:"REF"`
+}
+
+func (cmd *buildPush) Exec(prg cli.Program) error {
+	fmt.Fprintln(prg.Stdout(), cmd.Force, cmd.Retries, cmd.Timeout, cmd.Message, cmd.Modes, cmd.Remote, cmd.Refs)
+	return nil
+}
+
+type buildRemoteAdd struct {
+	Name string `arg:"0" repeating:"false"`
+}
+
+func (cmd *buildRemoteAdd) Exec(prg cli.Program) error {
+	fmt.Fprintln(prg.Stdout(), cmd.Name)
+	return nil
+}
+
+func TestBuild(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		args    []string
+		wantOut string
+	}{
+		{
+			desc:    "defaults and environment",
+			args:    []string{"test", "push", "origin"},
+			wantOut: "false 5 16 hello foo,bar origin []\n",
+		},
+		{
+			desc:    "options and args",
+			args:    []string{"test", "-v", "push", "-f", "-retries", "1", "-modes", "baz", "origin", "main", "dev"},
+			wantOut: "true 1 16 hello baz origin [main dev]\n",
+		},
+		{
+			desc:    "nested subcommand",
+			args:    []string{"test", "remote", "add", "origin"},
+			wantOut: "origin\n",
+		},
+		{
+			desc: "root help",
+			args: []string{"test", "-h"},
+			wantOut: `USAGE:
+    test [OPTIONS] [COMMAND]
+
+OPTIONS:
+    -v, -verbose    be verbose
+    -h, -help       print help information
+
+COMMANDS:
+    push    push refs to a remote
+
+SETUP:
+    remote    manage remotes (default)
+`,
+		},
+		{
+			desc: "help",
+			args: []string{"test", "push", "-h"},
+			wantOut: `push refs to a remote
+
+USAGE:
+    test push [OPTIONS] [--] <REMOTE> [REF ...]
+
+OPTIONS:
+    -f, -force            force the push
+        -message, -msg    set a message (default: "hello")
+        -modes            set modes
+
+NETWORK:
+        -retries <N>    retry N times (env: RETRIES)
+        -timeout        time out after some seconds
+
+GENERAL:
+    -h, -help    print help information
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var root buildRoot
+			cmd, err := cli.Build(&root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			var stdout strings.Builder
+			cmdl := cli.New(cmd, cli.HelpDescription("print help information"))
+			code, err := cmdl.Invoke(context.Background(), cli.Invocation{
+				Args:   tc.args,
+				Stdout: &stdout,
+				Env:    []string{"RETRIES=5"},
+			})
+			if want, got := 0, code; got != want {
+				t.Fatalf("want %d, got %d: %v", want, got, err)
+			}
+			if want, got := tc.wantOut, stdout.String(); got != want {
+				t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+			}
+		})
+	}
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			v       interface{}
+			wantErr string
+		}{
+			{buildRoot{}, "cli: cannot build command from cli_test.buildRoot, want a non-nil pointer to a struct"},
+			{(*buildRoot)(nil), "cli: cannot build command from *cli_test.buildRoot, want a non-nil pointer to a struct"},
+			{&struct {
+				N int `opt:"n" default:"foo"`
+			}{}, `cli: field N: bad default value: strconv.ParseInt: parsing "foo": invalid syntax`},
+			{&struct {
+				F float64 `opt:"f"`
+			}{}, "cli: field F: unsupported option type float64"},
+			{&struct {
+				S string `opt:"s" short:"ss"`
+			}{}, `cli: field S: short name must be a single character, got "ss"`},
+			{&struct {
+				A []string `arg:"0"`
+				B string   `arg:"1"`
+			}{}, "cli: field A: repeating argument must come last"},
+			{&struct {
+				A string `arg:"0"`
+				B string `arg:"0"`
+			}{}, "cli: fields A and B: same argument position 0"},
+			{&struct {
+				A string `arg:"1"`
+			}{}, `cli: field A: bad argument position "1"`},
+			{&struct {
+				A string `arg:"0" repeating:"true"`
+			}{}, "cli: field A: repeating argument must be of type []string"},
+			{&struct {
+				a string `opt:"a"`
+			}{}, "cli: field a is unexported"},
+			{&struct {
+				C int `cmd:"c"`
+			}{}, "cli: field C: unsupported command type int"},
+			{&struct {
+				C struct{} `cmd:"c" defaultcmd:"yes"`
+			}{}, `cli: field C: bad defaultcmd value: strconv.ParseBool: parsing "yes": invalid syntax`},
+		}
+		for _, tc := range testCases {
+			t.Run("", func(t *testing.T) {
+				_, err := cli.Build(tc.v)
+				if want, got := tc.wantErr, fmt.Sprint(err); got != want {
+					t.Fatalf("want %q, got %q", want, got)
+				}
+			})
+		}
+	})
+	t.Run("many runs", func(t *testing.T) {
+		var stdout strings.Builder
+		cmdl := cli.NewFunc(func() *cli.Command {
+			return cli.MustBuild(new(buildRoot))
+		}, cli.Stdout(&stdout))
+		cmdl.ParseAndRun([]string{"test", "push", "-modes", "baz", "-f", "origin"})
+		cmdl.ParseAndRun([]string{"test", "push", "origin"})
+		want := "true 3 16 hello baz origin []\nfalse 3 16 hello foo,bar origin []\n"
+		if got := stdout.String(); got != want {
+			t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+}
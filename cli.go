@@ -1,19 +1,19 @@
 package cli
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 )
 
-var errUnknown = errors.New("unknown command or flag")
-
 // CLI is a command-line interface wrapper that provides flags,
 // positional arguments and subcommands.
 //
@@ -26,19 +26,45 @@ var errUnknown = errors.New("unknown command or flag")
 //
 //   If the user makes a mistake by missing either a subcommand or a positional argument, it prints
 //   help to stderr.
+//
+// A CLI is never modified when run, but commands set values to recipients while parsing.
+// Recipients of positional arguments and of options of basic types are reset in every run,
+// but the ones of VarOption are not, so values from a previous run can leak into the next one.
+// Thus, a CLI can only be safely run many times and concurrently when its command tree
+// is built per run by using NewFunc.
 type CLI struct {
 	name           string
-	entry          *Command
+	entry          func() *Command
+	stdin          io.Reader
 	stdout, stderr io.Writer
+	env            []string
+	dir            string
 	helptxt        string
 	codes          struct{ err, misuse int }
+	strict         bool
+	interspersed   bool
+	stream         bool
+	showHidden     bool
+	strictDepr     bool
+	validate       bool
 }
 
 // New instantiates a new command-line interface with sane defaults,
-// which have outputs set to os.Stdout and os.Stderr.
+// which have input set to os.Stdin and outputs set to os.Stdout and os.Stderr.
+//
+// Since every run sets values to the same recipients of entry, running the CLI concurrently
+// is a data race, and running it many times leaks values of VarOption recipients from one
+// run into the next. Use NewFunc for either case.
 func New(entry *Command, opts ...func(*CLI)) *CLI {
+	return NewFunc(func() *Command { return entry }, opts...)
+}
+
+// NewFunc is just like New but calls newEntry in every run in order to build a new
+// command tree, which keeps recipients of concurrent runs apart from each other.
+func NewFunc(newEntry func() *Command, opts ...func(*CLI)) *CLI {
 	cli := &CLI{
-		entry:   entry,
+		entry:   newEntry,
+		stdin:   os.Stdin,
 		stdout:  os.Stdout,
 		stderr:  os.Stderr,
 		helptxt: "Print this help message.",
@@ -47,6 +73,11 @@ func New(entry *Command, opts ...func(*CLI)) *CLI {
 	for _, o := range opts {
 		o(cli)
 	}
+	if cli.validate {
+		if err := newEntry().Validate(); err != nil {
+			panic(err)
+		}
+	}
 	return cli
 }
 
@@ -61,45 +92,126 @@ func (cli *CLI) ParseAndRun(args []string) int {
 
 // ParseAndRunContext is just like ParseAndRun but accepts a custom context.
 func (cli *CLI) ParseAndRunContext(ctx context.Context, args []string) int {
-	if cli.entry == nil {
-		panic(fmt.Errorf("%s: cli: nil entry command", cli.name))
+	code, _ := cli.Invoke(ctx, Invocation{Args: args})
+	return code
+}
+
+// Invocation holds the input and outputs of a single run of a CLI.
+// Zero values fall back to what is configured for the CLI.
+type Invocation struct {
+	Args   []string  // Args are the raw arguments, starting with the program's executable.
+	Stdin  io.Reader // Stdin is the run's standard input.
+	Stdout io.Writer // Stdout is the run's standard output.
+	Stderr io.Writer // Stderr is the run's standard error.
+	Env    []string  // Env is the run's environment, in the same "key=value" form as os.Environ.
+	Dir    string    // Dir is the run's working directory.
+}
+
+// Invoke is just like ParseAndRunContext but uses inv's input and outputs
+// instead of the ones configured for the CLI, which remain untouched.
+//
+// Along with the status code, it returns the error that caused the run to fail, if any,
+// which is the same one returned by Run, except for when help is requested.
+func (cli *CLI) Invoke(ctx context.Context, inv Invocation) (int, error) {
+	prg := cli.newProgram(inv)
+	err := cli.run(ctx, prg)
+	var (
+		code     = 0 // success should always be 0, of course
+		helpErr  *HelpError
+		usageErr *UsageError
+	)
+	switch {
+	case err == nil:
+	case errors.As(err, &helpErr):
+		helpErr.WriteUsage(prg.stdout)
+		err = nil
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(prg.stderr, "%s: %v\n\n", prg.name, usageErr.Err)
+		usageErr.WriteUsage(prg.stderr)
+		code = cli.codes.misuse
+	default:
+		fmt.Fprintf(prg.lw.stderr, "%v: %v\n", prg.name, err)
+		code = cli.codes.err
 	}
-	if cli.name == "" {
+	prg.lw.flush()
+	return code, err
+}
+
+// Run parses arguments and runs a command just like ParseAndRunContext, but, instead of
+// printing errors and usage instructions, it returns them as one of the following errors:
+//
+//   *UsageError, when the command line is misused, wrapping an *UnknownCommandError
+//   when a subcommand is not defined
+//
+//   *HelpError, when help is requested, which is also the case for commands without Exec
+//
+//   *ExecError, when the command itself returns an error
+//
+// Besides those, the context's error is returned when it is done before a command runs.
+// Output of commands is still written to the CLI's outputs.
+func (cli *CLI) Run(ctx context.Context, args []string) error {
+	prg := cli.newProgram(Invocation{Args: args})
+	defer prg.lw.flush()
+	return cli.run(ctx, prg)
+}
+
+func (cli *CLI) newProgram(inv Invocation) *program {
+	name := cli.name
+	if name == "" {
 		// Strip parent directories from the executable's name.
-		cli.name = filepath.Base(args[0])
+		name = filepath.Base(inv.Args[0])
+	}
+	prg := &program{
+		name:  name,
+		path:  []string{name},
+		args:  inv.Args,
+		stdin: inv.Stdin,
+		env:   inv.Env,
+		dir:   inv.Dir,
+		lw:    &lazyWriter{stdout: inv.Stdout, stderr: inv.Stderr},
+	}
+	if prg.stdin == nil {
+		prg.stdin = cli.stdin
+	}
+	if prg.lw.stdout == nil {
+		prg.lw.stdout = cli.stdout
+	}
+	if prg.lw.stderr == nil {
+		prg.lw.stderr = cli.stderr
+	}
+	if prg.env == nil {
+		prg.env = cli.env
+	}
+	if prg.dir == "" {
+		prg.dir = cli.dir
+	}
+	prg.stdout = (*stdoutWriter)(prg.lw)
+	prg.stderr = (*stderrWriter)(prg.lw)
+	return prg
+}
+
+func (cli *CLI) run(ctx context.Context, prg *program) error {
+	entry := cli.entry()
+	if entry == nil {
+		panic(fmt.Errorf("%s: cli: nil entry command", prg.name))
 	}
-	// This buffer allows printing usage errors with the CLI's name as prefix.
-	// Declaring it here prevents from declaring it in every subcommand iteration.
-	buf := bytes.NewBufferString(fmt.Sprintf("%s: ", cli.name))
-	var (
-		code = 0 // success should always be 0, of course
-		err  error
-		lw   = &lazyWriter{stdout: cli.stdout, stderr: cli.stderr}
-	)
 	select {
 	case <-ctx.Done():
-		err = ctx.Err()
+		return ctx.Err()
 	default:
-		cli.stdout = (*stdoutWriter)(lw)
-		cli.stderr = (*stderrWriter)(lw)
-		run := cli.parse(ctx, cli.name, cli.entry, args[1:], buf)
-		if run == nil {
-			err = errUnknown
-		} else {
-			err = run()
-		}
 	}
-	// TODO: use custom status codes
+	run, err := cli.parse(ctx, prg, entry, prg.args[1:])
 	if err != nil {
-		if errors.Is(err, errUnknown) {
-			lw.flush()
-			return cli.codes.misuse
-		}
-		fmt.Fprintf(lw.stderr, "%v: %v\n", cli.name, err)
-		code = cli.codes.err
+		return err
+	}
+	return run()
+}
+
+// Stdin is a functional option for creating a CLI that sets r as stdin.
+func Stdin(r io.Reader) func(*CLI) {
+	return func(cli *CLI) {
+		cli.stdin = r
 	}
-	lw.flush()
-	return code
 }
 
 // Stdout is a functional option for creating a CLI that sets w as stdout.
@@ -116,6 +228,23 @@ func Stderr(w io.Writer) func(*CLI) {
 	}
 }
 
+// Env is a functional option for creating a CLI that sets environ as the environment
+// for its commands, in the same "key=value" form as os.Environ.
+// The default is the environment of the current process.
+func Env(environ []string) func(*CLI) {
+	return func(cli *CLI) {
+		cli.env = environ
+	}
+}
+
+// Dir is a functional option for creating a CLI that sets dir as the working directory
+// of its commands. The default is the working directory of the current process.
+func Dir(dir string) func(*CLI) {
+	return func(cli *CLI) {
+		cli.dir = dir
+	}
+}
+
 // HelpDescription changes the default help description message of the CLI.
 func HelpDescription(s string) func(*CLI) {
 	return func(cli *CLI) {
@@ -137,6 +266,64 @@ func MisuseCode(c int) func(*CLI) {
 	}
 }
 
+// Strict sets whether all commands of a CLI reject unexpected positional arguments,
+// regardless of their own Strict field. The default is false.
+func Strict(b bool) func(*CLI) {
+	return func(cli *CLI) {
+		cli.strict = b
+	}
+}
+
+// Interspersed sets whether options of a command are accepted after its positional arguments,
+// as in "push origin -force". Either way, parsing options stops at the "--" terminator.
+// The default is false, which means options must come right after their command.
+func Interspersed(b bool) func(*CLI) {
+	return func(cli *CLI) {
+		cli.interspersed = b
+	}
+}
+
+// Stream sets whether commands write straight through to stdout and stderr while running.
+// Output is still buffered while parsing arguments, which is flushed right before a command runs.
+// The default is false, which means all output is buffered until the command returns,
+// unless it is explicitly flushed by calling Program.Flush.
+func Stream(b bool) func(*CLI) {
+	return func(cli *CLI) {
+		cli.stream = b
+	}
+}
+
+// ShowHidden sets whether hidden commands and options are listed in help messages,
+// which is useful for maintainers, e.g. when set by an environment variable:
+//
+//   cli.ShowHidden(os.Getenv("MYCLI_DEBUG") != "")
+//
+// The default is false. Either way, hidden commands and options can always be used.
+func ShowHidden(b bool) func(*CLI) {
+	return func(cli *CLI) {
+		cli.showHidden = b
+	}
+}
+
+// StrictDeprecations sets whether deprecated commands and options are rejected
+// after their cutoff, which reports them as a misuse of the command line.
+// The default is false, which means they only print a warning when used.
+func StrictDeprecations(b bool) func(*CLI) {
+	return func(cli *CLI) {
+		cli.strictDepr = b
+	}
+}
+
+// Validate sets whether the command tree is validated when the CLI is created,
+// which panics with a *ValidationError when the tree has any problem.
+// For NewFunc, a command tree is built only for the validation.
+// The default is false, which means mistakes are only caught when running, if at all.
+func Validate(b bool) func(*CLI) {
+	return func(cli *CLI) {
+		cli.validate = b
+	}
+}
+
 // Name sets a fixed name for the program.
 // The default is the first string from parsed args.
 func Name(s string) func(*CLI) {
@@ -145,15 +332,16 @@ func Name(s string) func(*CLI) {
 	}
 }
 
-func (cli *CLI) parse(ctx context.Context, name string, c *Command, args []string, flagOut *bytes.Buffer) func() error {
+func (cli *CLI) parse(ctx context.Context, prg *program, c *Command, args []string) (func() error, error) {
+	name := strings.Join(prg.path, " ")
 	f := flag.NewFlagSet(name, flag.ContinueOnError)
-	// Suppress default help messages, since they are printed to stderr even when explicitly requested.
+	// Suppress default error and help messages, since errors are returned
+	// and help is printed by the caller, to the correct output.
 	// See more at https://www.jstorimer.com/blogs/workingwithcode/7766119-when-to-use-stderr-instead-of-stdout.
+	f.SetOutput(ioutil.Discard)
+	f.Usage = func() {}
 	var help bool
-	if c.Options == nil {
-		c.Options = make(map[string]Option, 1)
-	}
-	c.Options["help"] = BoolOption{
+	helpOpt := BoolOption{
 		OptionDetails: OptionDetails{
 			Description: cli.helptxt,
 			Short:       'h',
@@ -161,86 +349,325 @@ func (cli *CLI) parse(ctx context.Context, name string, c *Command, args []strin
 		Recipient: &help,
 	}
 	// Define flags and their aliases to the respective flag set.
-	for name, fg := range c.Options {
-		fg.Define(f, name)
-	}
-	// The usage function shows the short, less complete description, in order to not be confuse
-	// when a user types a wrong flag.
-	f.Usage = func() {
-		w := cli.stdout
-		if !help {
-			w = f.Output()
-		}
-		tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
-		c.writeUsage(tw, name, help)
-		if err := tw.Flush(); err != nil {
-			panic(err)
+	// The help option is not added to the command's options, since commands
+	// must not be modified, but it takes precedence over any option named "help".
+	// It is also defined first, so options that clash with it are the ones reported.
+	opts := c.options(NamedOption{"help", helpOpt})
+	canonical := make(map[string]string, len(opts))
+	negations := make(map[string]string)
+	helpOpt.Define(f, "help")
+	for _, o := range opts {
+		if o.Name != "help" {
+			o.Option.Define(f, o.Name)
+		}
+		canonical[o.Name] = o.Name
+		if b, ok := o.Option.(BoolOption); ok && b.Negatable {
+			negations["no-"+o.Name] = o.Name
+		}
+		details := optionDetails(o.Option)
+		if details.Short != 0 {
+			canonical[string(details.Short)] = o.Name
+		}
+		for _, alias := range details.Aliases {
+			canonical[alias] = o.Name
 		}
 	}
-	f.SetOutput(flagOut)
-	if err := f.Parse(args); err != nil {
-		flagOut.WriteTo(cli.stderr)
+	// The usage function for errors shows the short, less complete description,
+	// in order to not be confuse when a user types a wrong flag.
+	usage := func(showDesc bool) func(io.Writer) {
+		return func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+			c.writeUsage(tw, name, helpOpt, showDesc, cli.showHidden)
+			if err := tw.Flush(); err != nil {
+				panic(err)
+			}
+		}
+	}
+	path := prg.Path()
+	misuse := func(err error) (func() error, error) {
+		return nil, &UsageError{Path: path, Err: err, usage: usage(false)}
+	}
+	helpErr := &HelpError{Path: path, usage: usage(true)}
+	// Once all of the command's options have been parsed, right before running or
+	// descending into a subcommand, environment variables are applied and options
+	// are checked for conflicts, limits and deprecation.
+	complete := func() error {
+		used := make(map[string]bool)
+		negated := make(map[string]bool)
+		f.Visit(func(fg *flag.Flag) {
+			if n, ok := negations[fg.Name]; ok {
+				negated[n] = true
+				return
+			}
+			used[canonical[fg.Name]] = true
+		})
+		// Environment variables override default values, but not the command line.
+		for _, o := range opts {
+			env := optionDetails(o.Option).Env
+			if env == "" || used[o.Name] || negated[o.Name] {
+				continue
+			}
+			if v, ok := prg.LookupEnv(env); ok {
+				if err := f.Set(o.Name, v); err != nil {
+					return fmt.Errorf("invalid value %q for environment variable %s: %v", v, env, err)
+				}
+			}
+		}
+		for _, o := range opts {
+			if used[o.Name] && negated[o.Name] {
+				return fmt.Errorf("conflicting options: -%s and -no-%[1]s", o.Name)
+			}
+			if co, ok := o.Option.(CountOption); ok {
+				if err := f.Lookup(o.Name).Value.(*counter).check(o.Name, co.Max); err != nil {
+					return err
+				}
+			}
+		}
+		if d := c.Deprecated; d != nil {
+			if err := d.check(prg, fmt.Sprintf("command %q", name), cli.strictDepr); err != nil {
+				return err
+			}
+		}
+		for _, o := range opts {
+			d := optionDetails(o.Option).Deprecated
+			if d == nil || !used[o.Name] && !negated[o.Name] {
+				continue
+			}
+			if err := d.check(prg, "option -"+o.Name, cli.strictDepr); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
+	descend := func(name string, sc *Command, args []string) (func() error, error) {
+		if err := complete(); err != nil {
+			return misuse(err)
+		}
+		prg.path = append(prg.path, name)
+		return cli.parse(ctx, prg, sc, args)
+	}
+	// Options the command doesn't define are left to its default subcommand, if any.
+	var rest []string
+	if c.DefaultSubcommand != "" {
+		args, rest = splitUnknown(f, args)
+	}
+	if err := f.Parse(args); err != nil {
+		return misuse(err)
+	}
 	if help {
-		return usageFunc(f)
+		return nil, helpErr
 	}
+	// Arguments after the "--" terminator are always positional,
+	// so they are never treated as subcommands.
+	term := terminated(f, args)
 	sub := f.Arg(0)
 	args = f.Args()
+	if sub == "" && !term && c.DefaultSubcommand != "" {
+		sub = c.DefaultSubcommand
+		args = append([]string{sub}, rest...)
+	}
 	// Prevent hitting subcommands map when not needed.
 	// Also, when there are no subcommands, process args.
-	if sub == "" || len(c.Subcommands) == 0 {
+	if term || sub == "" || !c.hasSubcommands() {
+		goto exec
+	}
+	if sc, ok := c.subcommand(sub); ok {
+		return descend(sub, sc, args[1:])
+	}
+	if c.takesArg() {
+		// Arguments that don't name a subcommand are the command's own.
 		goto exec
 	}
-	if c, ok := c.Subcommands[sub]; ok {
-		return cli.parse(ctx, sub, c, args[1:], flagOut)
+	if def := c.DefaultSubcommand; def != "" {
+		// Otherwise, they are the default subcommand's, as long as it takes them,
+		// so that mistyped subcommands are still reported as such.
+		if sc, ok := c.subcommand(def); ok && sc.takesArg() {
+			return descend(def, sc, args)
+		}
 	}
 	if sub != "" {
 		// Bad subcommand.
-		cli.printErr(f, fmt.Errorf("command provided but not defined: %s", sub))
-		return nil
+		return misuse(&UnknownCommandError{Name: sub})
 	}
 exec:
 	if c.Exec == nil {
 		// Command exists BUT has no function attributed to it.
 		// This means it should print help to stdout, like Git does.
-		help = true // XXX
-		return usageFunc(f)
+		return nil, helpErr
+	}
+	if cli.interspersed && !term {
+		var err error
+		if args, err = interspersed(f, args); err != nil {
+			return misuse(err)
+		}
+		if help {
+			return nil, helpErr
+		}
+	}
+	if err := complete(); err != nil {
+		return misuse(err)
 	}
 	arglist := new(ArgList)
 	if arg := c.Arg; arg != nil {
 		arg.AppendTo(arglist)
-		if a := arglist.missing(args); a != nil {
+		if err := arglist.check(args); err != nil {
 			// Bad arguments.
-			cli.printErr(f, fmt.Errorf("missing required argument: %s", a.name))
-			return nil
+			return misuse(err)
 		}
 		if err := arglist.parse(args); err != nil {
-			cli.printErr(f, fmt.Errorf("bad argument parsing: %w", err))
-			return nil
+			return misuse(fmt.Errorf("bad argument parsing: %w", err))
 		}
 	}
+	if extra := arglist.surplus(args); len(extra) > 0 && (cli.strict || c.Strict) {
+		return misuse(unexpectedArgs(extra))
+	}
+	prg.rest = arglist.surplus(args)
 	return func() error {
-		prg := (*cliMeta)(cli)
-		return c.Exec(prg)
+		if cli.stream {
+			if err := prg.lw.flush(); err != nil {
+				return err
+			}
+			prg.lw.mu.Lock()
+			prg.lw.stream = true
+			prg.lw.mu.Unlock()
+		}
+		if err := c.Exec(prg); err != nil {
+			return &ExecError{Path: path, Err: err}
+		}
+		return nil
+	}, nil
+}
+
+// terminated reports whether f has stopped parsing args because of the "--" terminator.
+// It walks through the args consumed by f in order to tell a terminator apart from
+// a "--" that is the value of a non-boolean flag.
+func terminated(f *flag.FlagSet, args []string) bool {
+	n := len(args) - f.NArg()
+	for i := 0; i < n; i++ {
+		s := args[i]
+		if s == "--" {
+			return true
+		}
+		name := strings.TrimLeft(s, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if fg := f.Lookup(name); fg != nil && !isBoolFlag(fg.Value) {
+			i++ // skip the flag's value
+		}
 	}
+	return false
 }
 
-func (cli *CLI) printErr(f *flag.FlagSet, err error) {
-	fmt.Fprintf(cli.stderr, "%s: %v\n\n", cli.name, err)
-	f.SetOutput(cli.stderr)
-	f.Usage()
+// splitUnknown splits args right before the first option that is not defined in f.
+// Options are looked for only until the first positional argument or the "--" terminator.
+func splitUnknown(f *flag.FlagSet, args []string) ([]string, []string) {
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		if len(s) < 2 || s[0] != '-' || s == "--" {
+			break
+		}
+		name := strings.TrimLeft(s, "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+		fg := f.Lookup(name)
+		if fg == nil {
+			return args[:i], args[i:]
+		}
+		if !hasValue && !isBoolFlag(fg.Value) {
+			i++ // skip the flag's value
+		}
+	}
+	return args, nil
 }
 
-type cliMeta CLI
+// interspersed parses options that are found between the positional arguments in args,
+// which must start with a positional argument, and returns only the positional ones.
+func interspersed(f *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for len(args) > 0 {
+		pos = append(pos, args[0])
+		rest := args[1:]
+		if err := f.Parse(rest); err != nil {
+			return nil, err
+		}
+		if terminated(f, rest) {
+			return append(pos, f.Args()...), nil
+		}
+		args = f.Args()
+	}
+	return pos, nil
+}
 
-func (cli *cliMeta) Name() string      { return cli.name }
-func (cli *cliMeta) Stdout() io.Writer { return cli.stdout }
-func (cli *cliMeta) Stderr() io.Writer { return cli.stderr }
+func isBoolFlag(v flag.Value) bool {
+	bf, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
 
-func usageFunc(f *flag.FlagSet) func() error {
-	return func() error {
-		f.Usage()
-		return nil
+func unexpectedArgs(args []string) error {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = strconv.Quote(a)
+	}
+	noun := "argument"
+	if len(args) > 1 {
+		noun += "s"
+	}
+	return fmt.Errorf("unexpected %s: %s", noun, strings.Join(quoted, " "))
+}
+
+type program struct {
+	name           string
+	path           []string
+	args, rest     []string
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	env            []string
+	dir            string
+	lw             *lazyWriter
+}
+
+func (prg *program) Name() string      { return prg.name }
+func (prg *program) Path() []string    { return append([]string(nil), prg.path...) }
+func (prg *program) RawArgs() []string { return append([]string(nil), prg.args...) }
+func (prg *program) Args() []string    { return append([]string(nil), prg.rest...) }
+func (prg *program) Stdin() io.Reader  { return prg.stdin }
+func (prg *program) Stdout() io.Writer { return prg.stdout }
+func (prg *program) Stderr() io.Writer { return prg.stderr }
+func (prg *program) Flush() error      { return prg.lw.flush() }
+
+func (prg *program) Getenv(key string) string {
+	v, _ := prg.LookupEnv(key)
+	return v
+}
+
+func (prg *program) LookupEnv(key string) (string, bool) {
+	if prg.env == nil {
+		return os.LookupEnv(key)
+	}
+	// Just like os/exec, the last value wins for duplicate keys.
+	prefix := key + "="
+	for i := len(prg.env) - 1; i >= 0; i-- {
+		if kv := prg.env[i]; strings.HasPrefix(kv, prefix) {
+			return kv[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+func (prg *program) Environ() []string {
+	if prg.env == nil {
+		return os.Environ()
+	}
+	return append([]string(nil), prg.env...)
+}
+
+func (prg *program) Dir() string {
+	if prg.dir == "" {
+		wd, _ := os.Getwd()
+		return wd
 	}
+	return prg.dir
 }
@@ -5,15 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gbrlsnchs/cli"
+	"github.com/gbrlsnchs/cli/cliutil"
 	"github.com/google/go-cmp/cmp"
 )
 
 func TestCommandLine(t *testing.T) {
 	testCommandLineParseAndRun(t)
+	testCommandLineProgram(t)
+	testCommandLineOutput(t)
+	testCommandLineReentrancy(t)
+	testCommandLineInvoke(t)
+	testCommandLineRun(t)
+	testCommandLineShortNames(t)
 }
 
 func testCommandLineParseAndRun(t *testing.T) {
@@ -232,14 +242,14 @@ OPTIONS:
 			args:     []string{"test", "-h"},
 			wantCode: 0,
 			wantOut: `USAGE:
-    test [OPTIONS] [FOO]
+    test [OPTIONS] [--] [FOO]
 
 OPTIONS:
     -h, -help    print help information
 `,
 			wantErr: "",
 			wantCombined: `USAGE:
-    test [OPTIONS] [FOO]
+    test [OPTIONS] [--] [FOO]
 
 OPTIONS:
     -h, -help    print help information
@@ -310,14 +320,14 @@ OPTIONS:
 			args:     []string{"test", "-h"},
 			wantCode: 0,
 			wantOut: `USAGE:
-    test [OPTIONS] <FOO>
+    test [OPTIONS] [--] <FOO>
 
 OPTIONS:
     -h, -help    print help information
 `,
 			wantErr: "",
 			wantCombined: `USAGE:
-    test [OPTIONS] <FOO>
+    test [OPTIONS] [--] <FOO>
 
 OPTIONS:
     -h, -help    print help information
@@ -346,7 +356,7 @@ OPTIONS:
 			wantErr: `test: missing required argument: FOO
 
 USAGE:
-    test [OPTIONS] <FOO>
+    test [OPTIONS] [--] <FOO>
 
 OPTIONS:
     -h, -help    print help information
@@ -354,7 +364,7 @@ OPTIONS:
 			wantCombined: `test: missing required argument: FOO
 
 USAGE:
-    test [OPTIONS] <FOO>
+    test [OPTIONS] [--] <FOO>
 
 OPTIONS:
     -h, -help    print help information
@@ -415,14 +425,14 @@ OPTIONS:
 			args:     []string{"test", "-h"},
 			wantCode: 0,
 			wantOut: `USAGE:
-    test [OPTIONS] [FOO [BAR]]
+    test [OPTIONS] [--] [FOO [BAR]]
 
 OPTIONS:
     -h, -help    print help information
 `,
 			wantErr: "",
 			wantCombined: `USAGE:
-    test [OPTIONS] [FOO [BAR]]
+    test [OPTIONS] [--] [FOO [BAR]]
 
 OPTIONS:
     -h, -help    print help information
@@ -514,14 +524,14 @@ OPTIONS:
 			args:     []string{"test", "-h"},
 			wantCode: 0,
 			wantOut: `USAGE:
-    test [OPTIONS] <FOO> [BAR]
+    test [OPTIONS] [--] <FOO> [BAR]
 
 OPTIONS:
     -h, -help    print help information
 `,
 			wantErr: "",
 			wantCombined: `USAGE:
-    test [OPTIONS] <FOO> [BAR]
+    test [OPTIONS] [--] <FOO> [BAR]
 
 OPTIONS:
     -h, -help    print help information
@@ -619,14 +629,14 @@ OPTIONS:
 			args:     []string{"test", "-h"},
 			wantCode: 0,
 			wantOut: `USAGE:
-    test [OPTIONS] [FOO ...]
+    test [OPTIONS] [--] [FOO ...]
 
 OPTIONS:
     -h, -help    print help information
 `,
 			wantErr: "",
 			wantCombined: `USAGE:
-    test [OPTIONS] [FOO ...]
+    test [OPTIONS] [--] [FOO ...]
 
 OPTIONS:
     -h, -help    print help information
@@ -678,7 +688,7 @@ OPTIONS:
 			wantErr: `test: missing required argument: FOO
 
 USAGE:
-    test [OPTIONS] <FOO> [...]
+    test [OPTIONS] [--] <FOO> [...]
 
 OPTIONS:
     -h, -help    print help information
@@ -686,7 +696,7 @@ OPTIONS:
 			wantCombined: `test: missing required argument: FOO
 
 USAGE:
-    test [OPTIONS] <FOO> [...]
+    test [OPTIONS] [--] <FOO> [...]
 
 OPTIONS:
     -h, -help    print help information
@@ -712,14 +722,14 @@ OPTIONS:
 			args:     []string{"test", "-h"},
 			wantCode: 0,
 			wantOut: `USAGE:
-    test [OPTIONS] <FOO> [...]
+    test [OPTIONS] [--] <FOO> [...]
 
 OPTIONS:
     -h, -help    print help information
 `,
 			wantErr: "",
 			wantCombined: `USAGE:
-    test [OPTIONS] <FOO> [...]
+    test [OPTIONS] [--] <FOO> [...]
 
 OPTIONS:
     -h, -help    print help information
@@ -747,6 +757,133 @@ OPTIONS:
 			wantErr:      "",
 			wantCombined: "",
 		},
+		{
+			desc: "main command with bounded repeating arg",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					if want, got := []string{"foo", "bar"}, root.rargs; !cmp.Equal(got, want) {
+						t.Fatalf("(-want +got):\n%s", cmp.Diff(want, got))
+					}
+					return nil
+				},
+				Subcommands: nil,
+				Arg: cli.RepeatingArg{
+					Label:     "FOO",
+					Min:       2,
+					Max:       3,
+					Recipient: &root.rargs,
+				},
+			},
+			args:         []string{"test", "foo", "bar"},
+			wantCode:     0,
+			wantOut:      "",
+			wantErr:      "",
+			wantCombined: "",
+		},
+		{
+			desc: "main command with too few occurrences of bounded repeating arg",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					t.Fatal("command should not have run")
+					return nil
+				},
+				Subcommands: nil,
+				Arg: cli.RepeatingArg{
+					Label:     "FOO",
+					Min:       2,
+					Max:       3,
+					Recipient: &root.rargs,
+				},
+			},
+			args:     []string{"test", "foo"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: not enough arguments for FOO: want at least 2, got 1
+
+USAGE:
+    test [OPTIONS] [--] <FOO> [...]{2,3}
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantCombined: `test: not enough arguments for FOO: want at least 2, got 1
+
+USAGE:
+    test [OPTIONS] [--] <FOO> [...]{2,3}
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "main command with too many occurrences of bounded repeating arg",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					t.Fatal("command should not have run")
+					return nil
+				},
+				Subcommands: nil,
+				Arg: cli.RepeatingArg{
+					Label:     "FOO",
+					Max:       2,
+					Recipient: &root.rargs,
+				},
+			},
+			args:     []string{"test", "foo", "bar", "baz"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: too many arguments for FOO: want at most 2, got 3
+
+USAGE:
+    test [OPTIONS] [--] [FOO ...]{,2}
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantCombined: `test: too many arguments for FOO: want at most 2, got 3
+
+USAGE:
+    test [OPTIONS] [--] [FOO ...]{,2}
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "print help of main command with required repeating arg and minimum count",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					t.Fatal("command should not have run")
+					return nil
+				},
+				Subcommands: nil,
+				Arg: cli.RepeatingArg{
+					Label:     "FOO",
+					Required:  true,
+					Min:       3,
+					Recipient: &root.rargs,
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] [--] <FOO> [...]{3,}
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] [--] <FOO> [...]{3,}
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
 		{
 			desc: "main command with options",
 			entry: &cli.Command{
@@ -873,35 +1010,2068 @@ OPTIONS:
 						OptionDetails: cli.OptionDetails{
 							Description: "just a dull option",
 						},
-						Recipient: newDullStr(),
+						Recipient: newDullStr(),
+					},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -b, -bool <TRUE|FALSE>        pass a boolean here
+        -dull                     just a dull option
+    -h, -help                     print help information
+    -i, -int <NUMBER>             pass an integer here
+    -I, -int64 <64-BIT NUMBER>    pass a 64-bit integer here
+    -s, -string <TEXT>            pass a string here (default: "bar")
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -b, -bool <TRUE|FALSE>        pass a boolean here
+        -dull                     just a dull option
+    -h, -help                     print help information
+    -i, -int <NUMBER>             pass an integer here
+    -I, -int64 <64-BIT NUMBER>    pass a 64-bit integer here
+    -s, -string <TEXT>            pass a string here (default: "bar")
+`,
+		},
+		{
+			desc: "main command ignoring unexpected args",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					if want, got := "foo", root.parg1; got != want {
+						t.Fatalf("want %q, got %q", want, got)
+					}
+					return nil
+				},
+				Arg: cli.StringArg{
+					Label:     "FOO",
+					Recipient: &root.parg1,
+				},
+			},
+			args:         []string{"test", "foo", "bar"},
+			wantCode:     0,
+			wantOut:      "",
+			wantErr:      "",
+			wantCombined: "",
+		},
+		{
+			desc: "strict main command with unexpected args",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					t.Fatal("command should not have run")
+					return nil
+				},
+				Arg: cli.StringArg{
+					Label:     "FOO",
+					Recipient: &root.parg1,
+				},
+				Strict: true,
+			},
+			args:     []string{"test", "foo", "bar", "baz qux"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: unexpected arguments: "bar" "baz qux"
+
+USAGE:
+    test [OPTIONS] [--] [FOO]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantCombined: `test: unexpected arguments: "bar" "baz qux"
+
+USAGE:
+    test [OPTIONS] [--] [FOO]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "strict CLI with unexpected arg to subcommand without args",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Exec: func(_ cli.Program) error {
+							t := root.T
+							t.Fatal("command should not have run")
+							return nil
+						},
+					},
+				},
+			},
+			opts: []func(*cli.CLI){
+				cli.Strict(true),
+			},
+			args:     []string{"test", "status", "foo"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: unexpected argument: "foo"
+
+USAGE:
+    test status [OPTIONS]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantCombined: `test: unexpected argument: "foo"
+
+USAGE:
+    test status [OPTIONS]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "strict CLI with repeating arg",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					if want, got := []string{"foo", "bar"}, root.rargs; !cmp.Equal(got, want) {
+						t.Fatalf("(-want +got):\n%s", cmp.Diff(want, got))
+					}
+					return nil
+				},
+				Arg: cli.RepeatingArg{
+					Label:     "FOO",
+					Recipient: &root.rargs,
+				},
+			},
+			opts: []func(*cli.CLI){
+				cli.Strict(true),
+			},
+			args:         []string{"test", "foo", "bar"},
+			wantCode:     0,
+			wantOut:      "",
+			wantErr:      "",
+			wantCombined: "",
+		},
+		{
+			desc: "main command with negative number after terminator",
+			entry: &cli.Command{
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.parg1)
+					return nil
+				},
+				Arg: cli.StringArg{
+					Label:     "NUMBER",
+					Required:  true,
+					Recipient: &root.parg1,
+				},
+			},
+			args:         []string{"test", "--", "-1"},
+			wantCode:     0,
+			wantOut:      "-1\n",
+			wantErr:      "",
+			wantCombined: "-1\n",
+		},
+		{
+			desc: "main command with dash-prefixed repeating args after terminator",
+			entry: &cli.Command{
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), strings.Join(root.rargs, " "))
+					return nil
+				},
+				Arg: cli.RepeatingArg{
+					Label:     "FOO",
+					Recipient: &root.rargs,
+				},
+			},
+			args:         []string{"test", "--", "-foo", "--", "-2"},
+			wantCode:     0,
+			wantOut:      "-foo -- -2\n",
+			wantErr:      "",
+			wantCombined: "-foo -- -2\n",
+		},
+		{
+			desc: "subcommand with negative number after terminator",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"foo": {
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), root.parg1)
+							return nil
+						},
+						Arg: cli.StringArg{
+							Label:     "NUMBER",
+							Required:  true,
+							Recipient: &root.parg1,
+						},
+					},
+				},
+			},
+			args:         []string{"test", "foo", "--", "-1"},
+			wantCode:     0,
+			wantOut:      "-1\n",
+			wantErr:      "",
+			wantCombined: "-1\n",
+		},
+		{
+			desc: "subcommand name after terminator",
+			entry: &cli.Command{
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), "main command")
+					return nil
+				},
+				Subcommands: map[string]*cli.Command{
+					"foo": {
+						Exec: func(_ cli.Program) error {
+							t := root.T
+							t.Fatal("subcommand should not have run")
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "--", "foo"},
+			wantCode:     0,
+			wantOut:      "main command\n",
+			wantErr:      "",
+			wantCombined: "main command\n",
+		},
+		{
+			desc: "terminator as an option value",
+			entry: &cli.Command{
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintf(prg.Stdout(), "%s %s\n", root.fstr, root.parg1)
+					return nil
+				},
+				Options: map[string]cli.Option{
+					"string": cli.StringOption{
+						OptionDetails: cli.OptionDetails{
+							Short: 's',
+						},
+						Recipient: &root.fstr,
+					},
+				},
+				Arg: cli.StringArg{
+					Label:     "FOO",
+					Recipient: &root.parg1,
+				},
+			},
+			args:         []string{"test", "-s", "--", "--", "-foo"},
+			wantCode:     0,
+			wantOut:      "-- -foo\n",
+			wantErr:      "",
+			wantCombined: "-- -foo\n",
+		},
+		{
+			desc: "options after positional args",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"push": {
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), root.rargs, root.fbool)
+							return nil
+						},
+						Options: map[string]cli.Option{
+							"force": cli.BoolOption{
+								Recipient: &root.fbool,
+							},
+						},
+						Arg: cli.RepeatingArg{
+							Label:     "REF",
+							Recipient: &root.rargs,
+						},
+					},
+				},
+			},
+			args:         []string{"test", "push", "origin", "-force", "main"},
+			wantCode:     0,
+			wantOut:      "[origin -force main] false\n",
+			wantErr:      "",
+			wantCombined: "[origin -force main] false\n",
+		},
+		{
+			desc: "interspersed options after positional args",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"push": {
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), root.rargs, root.fbool)
+							return nil
+						},
+						Options: map[string]cli.Option{
+							"force": cli.BoolOption{
+								Recipient: &root.fbool,
+							},
+						},
+						Arg: cli.RepeatingArg{
+							Label:     "REF",
+							Recipient: &root.rargs,
+						},
+					},
+				},
+			},
+			opts: []func(*cli.CLI){
+				cli.Interspersed(true),
+			},
+			args:         []string{"test", "push", "origin", "-force", "main"},
+			wantCode:     0,
+			wantOut:      "[origin main] true\n",
+			wantErr:      "",
+			wantCombined: "[origin main] true\n",
+		},
+		{
+			desc: "interspersed options stopping at terminator",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"push": {
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), root.rargs, root.fbool)
+							return nil
+						},
+						Options: map[string]cli.Option{
+							"force": cli.BoolOption{
+								Recipient: &root.fbool,
+							},
+						},
+						Arg: cli.RepeatingArg{
+							Label:     "REF",
+							Recipient: &root.rargs,
+						},
+					},
+				},
+			},
+			opts: []func(*cli.CLI){
+				cli.Interspersed(true),
+			},
+			args:         []string{"test", "push", "origin", "--", "-force", "main"},
+			wantCode:     0,
+			wantOut:      "[origin -force main] false\n",
+			wantErr:      "",
+			wantCombined: "[origin -force main] false\n",
+		},
+		{
+			desc: "print help with interspersed options",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error {
+					t := root.T
+					t.Fatal("command should not have run")
+					return nil
+				},
+				Arg: cli.RepeatingArg{
+					Label:     "REF",
+					Recipient: &root.rargs,
+				},
+			},
+			opts: []func(*cli.CLI){
+				cli.Interspersed(true),
+			},
+			args:     []string{"test", "origin", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] [--] [REF ...]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] [--] [REF ...]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "print help of nested subcommand",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"remote": {
+						Subcommands: map[string]*cli.Command{
+							"add": {
+								Description: "add a remote",
+								Exec: func(_ cli.Program) error {
+									t := root.T
+									t.Fatal("command should not have run")
+									return nil
+								},
+								Arg: cli.StringArg{
+									Label:     "NAME",
+									Required:  true,
+									Recipient: &root.parg1,
+								},
+							},
+						},
+					},
+				},
+			},
+			args:     []string{"test", "remote", "add", "-h"},
+			wantCode: 0,
+			wantOut: `add a remote
+
+USAGE:
+    test remote add [OPTIONS] [--] <NAME>
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantErr: "",
+			wantCombined: `add a remote
+
+USAGE:
+    test remote add [OPTIONS] [--] <NAME>
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "nested subcommand path",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"remote": {
+						Subcommands: map[string]*cli.Command{
+							"add": {
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), prg.Name(), prg.Path())
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:         []string{"test", "remote", "add"},
+			wantCode:     0,
+			wantOut:      "test [test remote add]\n",
+			wantErr:      "",
+			wantCombined: "test [test remote add]\n",
+		},
+		{
+			desc: "ordered declarations",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"beta": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "this is beta"},
+						Recipient:     new(bool),
+					},
+				},
+				OrderedOptions: []cli.NamedOption{
+					{"zeta", cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "this is zeta"},
+						Recipient:     new(bool),
+					}},
+					{"alpha", cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "this is alpha"},
+						Recipient:     new(bool),
+					}},
+				},
+				Subcommands: map[string]*cli.Command{
+					"commit": {Description: "commit things"},
+				},
+				OrderedSubcommands: []cli.NamedCommand{
+					{"status", &cli.Command{Description: "show status"}},
+					{"add", &cli.Command{Description: "add things"}},
+				},
+			},
+			args:     []string{"test", "-help"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+        -zeta     this is zeta
+        -alpha    this is alpha
+        -beta     this is beta
+    -h, -help     print help information
+
+COMMANDS:
+    status    show status
+    add       add things
+    commit    commit things
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+        -zeta     this is zeta
+        -alpha    this is alpha
+        -beta     this is beta
+    -h, -help     print help information
+
+COMMANDS:
+    status    show status
+    add       add things
+    commit    commit things
+`,
+		},
+		{
+			desc: "option groups",
+			entry: &cli.Command{
+				Exec: func(_ cli.Program) error { return nil },
+				OrderedOptions: []cli.NamedOption{
+					{"verbose", cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Recipient:     new(bool),
+					}},
+					{"port", cli.IntOption{
+						OptionDetails: cli.OptionDetails{Description: "listen on PORT", ArgLabel: "PORT", Group: "Network"},
+						Recipient:     new(int),
+					}},
+					{"json", cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "print JSON", Group: "Output"},
+						Recipient:     new(bool),
+					}},
+					{"host", cli.StringOption{
+						OptionDetails: cli.OptionDetails{Description: "bind to HOST", ArgLabel: "HOST", Group: "Network"},
+						Recipient:     new(string),
+					}},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -v, -verbose    be verbose
+
+NETWORK:
+        -port <PORT>    listen on PORT
+        -host <HOST>    bind to HOST
+
+OUTPUT:
+        -json    print JSON
+
+GENERAL:
+    -h, -help    print help information
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -v, -verbose    be verbose
+
+NETWORK:
+        -port <PORT>    listen on PORT
+        -host <HOST>    bind to HOST
+
+OUTPUT:
+        -json    print JSON
+
+GENERAL:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "command categories",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"status":  {Description: "show status", Category: "Core commands"},
+					"users":   {Description: "manage users", Category: "Admin commands"},
+					"version": {Description: "print version"},
+				},
+				OrderedSubcommands: []cli.NamedCommand{
+					{"init", &cli.Command{Description: "initialize things", Category: "Core commands"}},
+					{"deploy", &cli.Command{Description: "deploy things", Category: "Core commands"}},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    version    print version
+
+CORE COMMANDS:
+    init      initialize things
+    deploy    deploy things
+    status    show status
+
+ADMIN COMMANDS:
+    users    manage users
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    version    print version
+
+CORE COMMANDS:
+    init      initialize things
+    deploy    deploy things
+    status    show status
+
+ADMIN COMMANDS:
+    users    manage users
+`,
+		},
+		{
+			desc: "hidden commands and options",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"migrate": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "run migrations", Hidden: true},
+						Recipient:     new(bool),
+					},
+				},
+				Subcommands: map[string]*cli.Command{
+					"status": {Description: "show status"},
+					"debug": {
+						Description: "debug things",
+						Hidden:      true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "debugging")
+							return nil
+						},
+					},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    status    show status
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    status    show status
+`,
+		},
+		{
+			desc: "only hidden commands",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"debug": {Description: "debug things", Hidden: true},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help    print help information
+`,
+		},
+		{
+			desc: "show hidden commands and options",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"migrate": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "run migrations", Hidden: true},
+						Recipient:     new(bool),
+					},
+				},
+				Subcommands: map[string]*cli.Command{
+					"status": {Description: "show status"},
+					"debug": {
+						Description: "debug things",
+						Hidden:      true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "debugging")
+							return nil
+						},
+					},
+				},
+			},
+			opts:     []func(*cli.CLI){cli.ShowHidden(true)},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help       print help information
+        -migrate    run migrations
+
+COMMANDS:
+    debug     debug things
+    status    show status
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help       print help information
+        -migrate    run migrations
+
+COMMANDS:
+    debug     debug things
+    status    show status
+`,
+		},
+		{
+			desc: "run hidden command with hidden option",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"migrate": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "run migrations", Hidden: true},
+						Recipient:     new(bool),
+					},
+				},
+				Subcommands: map[string]*cli.Command{
+					"status": {Description: "show status"},
+					"debug": {
+						Description: "debug things",
+						Hidden:      true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "debugging")
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "-migrate", "debug"},
+			wantCode:     0,
+			wantOut:      "debugging\n",
+			wantErr:      "",
+			wantCombined: "debugging\n",
+		},
+		{
+			desc: "deprecated command help",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"run": {
+						Description: "run things",
+						Options: map[string]cli.Option{
+							"old": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{
+									Description: "do the old thing",
+									Short:       'o',
+									Deprecated:  &cli.Deprecation{Message: "use -new instead", Cutoff: time.Now().Add(time.Hour)},
+								},
+								Recipient: new(bool),
+							},
+						},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "running")
+							return nil
+						},
+					},
+					"exec": {
+						Description: "run things too",
+						Deprecated:  &cli.Deprecation{Message: "use run instead"},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "executing")
+							return nil
+						},
+					},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    exec    run things too (deprecated)
+    run     run things
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    exec    run things too (deprecated)
+    run     run things
+`,
+		},
+		{
+			desc: "deprecated command",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"run": {
+						Description: "run things",
+						Options: map[string]cli.Option{
+							"old": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{
+									Description: "do the old thing",
+									Short:       'o',
+									Deprecated:  &cli.Deprecation{Message: "use -new instead", Cutoff: time.Now().Add(time.Hour)},
+								},
+								Recipient: new(bool),
+							},
+						},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "running")
+							return nil
+						},
+					},
+					"exec": {
+						Description: "run things too",
+						Deprecated:  &cli.Deprecation{Message: "use run instead"},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "executing")
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "exec"},
+			wantCode:     0,
+			wantOut:      "executing\n",
+			wantErr:      "test: warning: command \"test exec\" is deprecated: use run instead\n",
+			wantCombined: "test: warning: command \"test exec\" is deprecated: use run instead\nexecuting\n",
+		},
+		{
+			desc: "deprecated option used twice",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"run": {
+						Description: "run things",
+						Options: map[string]cli.Option{
+							"old": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{
+									Description: "do the old thing",
+									Short:       'o',
+									Deprecated:  &cli.Deprecation{Message: "use -new instead", Cutoff: time.Now().Add(-time.Hour)},
+								},
+								Recipient: new(bool),
+							},
+						},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "running")
+							return nil
+						},
+					},
+					"exec": {
+						Description: "run things too",
+						Deprecated:  &cli.Deprecation{Message: "use run instead"},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "executing")
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "run", "-o", "-old"},
+			wantCode:     0,
+			wantOut:      "running\n",
+			wantErr:      "test: warning: option -old is deprecated: use -new instead\n",
+			wantCombined: "test: warning: option -old is deprecated: use -new instead\nrunning\n",
+		},
+		{
+			desc: "deprecated option before cutoff with strict deprecations",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"run": {
+						Description: "run things",
+						Options: map[string]cli.Option{
+							"old": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{
+									Description: "do the old thing",
+									Short:       'o',
+									Deprecated:  &cli.Deprecation{Message: "use -new instead", Cutoff: time.Now().Add(time.Hour)},
+								},
+								Recipient: new(bool),
+							},
+						},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "running")
+							return nil
+						},
+					},
+					"exec": {
+						Description: "run things too",
+						Deprecated:  &cli.Deprecation{Message: "use run instead"},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "executing")
+							return nil
+						},
+					},
+				},
+			},
+			opts:         []func(*cli.CLI){cli.StrictDeprecations(true)},
+			args:         []string{"test", "run", "-old"},
+			wantCode:     0,
+			wantOut:      "running\n",
+			wantErr:      "test: warning: option -old is deprecated: use -new instead\n",
+			wantCombined: "test: warning: option -old is deprecated: use -new instead\nrunning\n",
+		},
+		{
+			desc: "deprecated option after cutoff with strict deprecations",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"run": {
+						Description: "run things",
+						Options: map[string]cli.Option{
+							"old": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{
+									Description: "do the old thing",
+									Short:       'o',
+									Deprecated:  &cli.Deprecation{Message: "use -new instead", Cutoff: time.Now().Add(-time.Hour)},
+								},
+								Recipient: new(bool),
+							},
+						},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "running")
+							return nil
+						},
+					},
+					"exec": {
+						Description: "run things too",
+						Deprecated:  &cli.Deprecation{Message: "use run instead"},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "executing")
+							return nil
+						},
+					},
+				},
+			},
+			opts:     []func(*cli.CLI){cli.StrictDeprecations(true)},
+			args:     []string{"test", "run", "-old"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: option -old is no longer supported: use -new instead
+
+USAGE:
+    test run [OPTIONS]
+
+OPTIONS:
+    -h, -help    print help information
+    -o, -old     do the old thing (deprecated)
+`,
+			wantCombined: `test: option -old is no longer supported: use -new instead
+
+USAGE:
+    test run [OPTIONS]
+
+OPTIONS:
+    -h, -help    print help information
+    -o, -old     do the old thing (deprecated)
+`,
+		},
+		{
+			desc: "option aliases help",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"dry-run": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{
+							Description: "do nothing",
+							Short:       'n',
+							Aliases:     []string{"dryrun"},
+						},
+						Recipient: &root.fbool,
+					},
+					"output": cli.StringOption{
+						OptionDetails: cli.OptionDetails{
+							Description: "write to FILE",
+							Aliases:     []string{"out", "o"},
+							ArgLabel:    "FILE",
+							Deprecated:  &cli.Deprecation{},
+						},
+						Recipient: &root.fstr,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fbool, root.fstr)
+					return nil
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -n, -dry-run, -dryrun           do nothing
+    -h, -help                       print help information
+        -output, -out, -o <FILE>    write to FILE (deprecated)
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -n, -dry-run, -dryrun           do nothing
+    -h, -help                       print help information
+        -output, -out, -o <FILE>    write to FILE (deprecated)
+`,
+		},
+		{
+			desc: "option aliases",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"dry-run": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{
+							Description: "do nothing",
+							Short:       'n',
+							Aliases:     []string{"dryrun"},
+						},
+						Recipient: &root.fbool,
+					},
+					"output": cli.StringOption{
+						OptionDetails: cli.OptionDetails{
+							Description: "write to FILE",
+							Aliases:     []string{"out", "o"},
+							ArgLabel:    "FILE",
+							Deprecated:  &cli.Deprecation{},
+						},
+						Recipient: &root.fstr,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fbool, root.fstr)
+					return nil
+				},
+			},
+			args:         []string{"test", "-dryrun", "-out", "foo"},
+			wantCode:     0,
+			wantOut:      "true foo\n",
+			wantErr:      "test: warning: option -output is deprecated\n",
+			wantCombined: "test: warning: option -output is deprecated\ntrue foo\n",
+		},
+		{
+			desc: "negatable option help",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"color": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "colorize output", Env: "COLOR"},
+						DefValue:      true,
+						Negatable:     true,
+						Recipient:     &root.fbool,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fbool)
+					return nil
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+        -color, -no-color    colorize output (env: COLOR)
+    -h, -help                print help information
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+        -color, -no-color    colorize output (env: COLOR)
+    -h, -help                print help information
+`,
+		},
+		{
+			desc: "negatable option default",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"color": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "colorize output", Env: "COLOR"},
+						DefValue:      true,
+						Negatable:     true,
+						Recipient:     &root.fbool,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fbool)
+					return nil
+				},
+			},
+			args:         []string{"test"},
+			wantCode:     0,
+			wantOut:      "true\n",
+			wantErr:      "",
+			wantCombined: "true\n",
+		},
+		{
+			desc: "negated option",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"color": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "colorize output", Env: "COLOR"},
+						DefValue:      true,
+						Negatable:     true,
+						Recipient:     &root.fbool,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fbool)
+					return nil
+				},
+			},
+			opts:         []func(*cli.CLI){cli.Env([]string{"COLOR=true"})},
+			args:         []string{"test", "-no-color"},
+			wantCode:     0,
+			wantOut:      "false\n",
+			wantErr:      "",
+			wantCombined: "false\n",
+		},
+		{
+			desc: "conflicting negatable option",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"color": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "colorize output", Env: "COLOR"},
+						DefValue:      true,
+						Negatable:     true,
+						Recipient:     &root.fbool,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fbool)
+					return nil
+				},
+			},
+			args:     []string{"test", "-color", "-no-color"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: conflicting options: -color and -no-color
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+        -color, -no-color    colorize output (env: COLOR)
+    -h, -help                print help information
+`,
+			wantCombined: `test: conflicting options: -color and -no-color
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+        -color, -no-color    colorize output (env: COLOR)
+    -h, -help                print help information
+`,
+		},
+		{
+			desc: "counter option help",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+		},
+		{
+			desc: "counter option",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:         []string{"test", "-v", "-verbose", "-v"},
+			wantCode:     0,
+			wantOut:      "3\n",
+			wantErr:      "",
+			wantCombined: "3\n",
+		},
+		{
+			desc: "counter option set to a number",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:         []string{"test", "-v=1"},
+			wantCode:     0,
+			wantOut:      "1\n",
+			wantErr:      "",
+			wantCombined: "1\n",
+		},
+		{
+			desc: "counter option repeated and set to a number",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:         []string{"test", "-v", "-v", "-v=1"},
+			wantCode:     0,
+			wantOut:      "1\n",
+			wantErr:      "",
+			wantCombined: "1\n",
+		},
+		{
+			desc: "counter option set to zero",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:         []string{"test", "-v", "-verbose=0"},
+			wantCode:     0,
+			wantOut:      "0\n",
+			wantErr:      "",
+			wantCombined: "0\n",
+		},
+		{
+			desc: "counter option set to a bad value",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:     []string{"test", "-v=abc"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: invalid count "abc" for -verbose: want a non-negative number
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+			wantCombined: `test: invalid count "abc" for -verbose: want a non-negative number
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+		},
+		{
+			desc: "counter option set to false",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:     []string{"test", "-v=false"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: invalid count "false" for -verbose: want a non-negative number
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+			wantCombined: `test: invalid count "false" for -verbose: want a non-negative number
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+		},
+		{
+			desc: "counter option set above maximum",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:     []string{"test", "-v=5"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: value of -verbose exceeds maximum: want at most 3, got 5
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+			wantCombined: `test: value of -verbose exceeds maximum: want at most 3, got 5
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+		},
+		{
+			desc: "counter option without description",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Short: 'v'},
+						Recipient:     new(int),
+					},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    (repeatable)
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    (repeatable)
+`,
+		},
+		{
+			desc: "counter option above maximum",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Max:           3,
+						Recipient:     &root.fint,
+					},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), root.fint)
+					return nil
+				},
+			},
+			args:     []string{"test", "-v", "-v", "-v", "-v"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: too many occurrences of -verbose: want at most 3, got 4
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+			wantCombined: `test: too many occurrences of -verbose: want at most 3, got 4
+
+USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose (repeatable, at most 3 times)
+`,
+		},
+		{
+			desc: "default subcommand help",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Recipient:     &root.fbool,
+					},
+				},
+				DefaultSubcommand: "status",
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Description: "show status",
+						Options: map[string]cli.Option{
+							"short": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{Description: "be short", Short: 's'},
+								Recipient:     new(bool),
+							},
+						},
+						Arg: cli.StringArg{Label: "PATH", Recipient: &root.parg1},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path(), prg.RawArgs()[1:], root.fbool, root.parg1)
+							return nil
+						},
+					},
+					"log": {
+						Description: "show log",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path())
+							return nil
+						},
+					},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] [COMMAND]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose
+
+COMMANDS:
+    log       show log
+    status    show status (default)
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] [COMMAND]
+
+OPTIONS:
+    -h, -help       print help information
+    -v, -verbose    be verbose
+
+COMMANDS:
+    log       show log
+    status    show status (default)
+`,
+		},
+		{
+			desc: "default subcommand",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Recipient:     &root.fbool,
+					},
+				},
+				DefaultSubcommand: "status",
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Description: "show status",
+						Options: map[string]cli.Option{
+							"short": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{Description: "be short", Short: 's'},
+								Recipient:     new(bool),
+							},
+						},
+						Arg: cli.StringArg{Label: "PATH", Recipient: &root.parg1},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path(), prg.RawArgs()[1:], root.fbool, root.parg1)
+							return nil
+						},
+					},
+					"log": {
+						Description: "show log",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path())
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test"},
+			wantCode:     0,
+			wantOut:      "[test status] [] false \n",
+			wantErr:      "",
+			wantCombined: "[test status] [] false \n",
+		},
+		{
+			desc: "default subcommand with options and args",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Recipient:     &root.fbool,
+					},
+				},
+				DefaultSubcommand: "status",
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Description: "show status",
+						Options: map[string]cli.Option{
+							"short": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{Description: "be short", Short: 's'},
+								Recipient:     new(bool),
+							},
+						},
+						Arg: cli.StringArg{Label: "PATH", Recipient: &root.parg1},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path(), prg.RawArgs()[1:], root.fbool, root.parg1)
+							return nil
+						},
+					},
+					"log": {
+						Description: "show log",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path())
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "-v", "-short", "foo"},
+			wantCode:     0,
+			wantOut:      "[test status] [-v -short foo] true foo\n",
+			wantErr:      "",
+			wantCombined: "[test status] [-v -short foo] true foo\n",
+		},
+		{
+			desc: "default subcommand with args only",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Recipient:     &root.fbool,
+					},
+				},
+				DefaultSubcommand: "status",
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Description: "show status",
+						Options: map[string]cli.Option{
+							"short": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{Description: "be short", Short: 's'},
+								Recipient:     new(bool),
+							},
+						},
+						Arg: cli.StringArg{Label: "PATH", Recipient: &root.parg1},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path(), prg.RawArgs()[1:], root.fbool, root.parg1)
+							return nil
+						},
+					},
+					"log": {
+						Description: "show log",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path())
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "x.txt"},
+			wantCode:     0,
+			wantOut:      "[test status] [x.txt] false x.txt\n",
+			wantErr:      "",
+			wantCombined: "[test status] [x.txt] false x.txt\n",
+		},
+		{
+			desc: "mistyped subcommand with default subcommand",
+			entry: &cli.Command{
+				DefaultSubcommand: "status",
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Description: "show status",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "status")
+							return nil
+						},
+					},
+					"push": {
+						Description: "push things",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "push")
+							return nil
+						},
+					},
+				},
+			},
+			args:     []string{"test", "psuh"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: command provided but not defined: psuh
+
+USAGE:
+    test [OPTIONS] [COMMAND]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    push      push things
+    status    show status (default)
+`,
+			wantCombined: `test: command provided but not defined: psuh
+
+USAGE:
+    test [OPTIONS] [COMMAND]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    push      push things
+    status    show status (default)
+`,
+		},
+		{
+			desc: "explicit subcommand with default subcommand",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"verbose": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Description: "be verbose", Short: 'v'},
+						Recipient:     &root.fbool,
+					},
+				},
+				DefaultSubcommand: "status",
+				Subcommands: map[string]*cli.Command{
+					"status": {
+						Description: "show status",
+						Options: map[string]cli.Option{
+							"short": cli.BoolOption{
+								OptionDetails: cli.OptionDetails{Description: "be short", Short: 's'},
+								Recipient:     new(bool),
+							},
+						},
+						Arg: cli.StringArg{Label: "PATH", Recipient: &root.parg1},
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path(), prg.RawArgs()[1:], root.fbool, root.parg1)
+							return nil
+						},
+					},
+					"log": {
+						Description: "show log",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), prg.Path())
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test", "-v", "log"},
+			wantCode:     0,
+			wantOut:      "[test log]\n",
+			wantErr:      "",
+			wantCombined: "[test log]\n",
+		},
+		{
+			desc: "subcommands and args help",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"open": {
+						Description: "open a file",
+						Arg: cli.StringArg{
+							Label:     "FILE",
+							Recipient: &root.parg1,
+						},
+						Strict: true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+							return nil
+						},
+						Subcommands: map[string]*cli.Command{
+							"recent": {
+								Description: "open a recent file",
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), "opening recent")
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:     []string{"test", "open", "-h"},
+			wantCode: 0,
+			wantOut: `open a file
+
+USAGE:
+    test open [OPTIONS] [COMMAND]
+    test open [OPTIONS] [--] [FILE]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    recent    open a recent file
+`,
+			wantErr: "",
+			wantCombined: `open a file
+
+USAGE:
+    test open [OPTIONS] [COMMAND]
+    test open [OPTIONS] [--] [FILE]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    recent    open a recent file
+`,
+		},
+		{
+			desc: "subcommands and args with subcommand",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"open": {
+						Description: "open a file",
+						Arg: cli.StringArg{
+							Label:     "FILE",
+							Recipient: &root.parg1,
+						},
+						Strict: true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+							return nil
+						},
+						Subcommands: map[string]*cli.Command{
+							"recent": {
+								Description: "open a recent file",
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), "opening recent")
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:         []string{"test", "open", "recent"},
+			wantCode:     0,
+			wantOut:      "opening recent\n",
+			wantErr:      "",
+			wantCombined: "opening recent\n",
+		},
+		{
+			desc: "subcommands and args with arg",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"open": {
+						Description: "open a file",
+						Arg: cli.StringArg{
+							Label:     "FILE",
+							Recipient: &root.parg1,
+						},
+						Strict: true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+							return nil
+						},
+						Subcommands: map[string]*cli.Command{
+							"recent": {
+								Description: "open a recent file",
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), "opening recent")
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:         []string{"test", "open", "notes.txt"},
+			wantCode:     0,
+			wantOut:      "opening \"notes.txt\"\n",
+			wantErr:      "",
+			wantCombined: "opening \"notes.txt\"\n",
+		},
+		{
+			desc: "subcommands and args without arg",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"open": {
+						Description: "open a file",
+						Arg: cli.StringArg{
+							Label:     "FILE",
+							Recipient: &root.parg1,
+						},
+						Strict: true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+							return nil
+						},
+						Subcommands: map[string]*cli.Command{
+							"recent": {
+								Description: "open a recent file",
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), "opening recent")
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:         []string{"test", "open"},
+			wantCode:     0,
+			wantOut:      "opening \"\"\n",
+			wantErr:      "",
+			wantCombined: "opening \"\"\n",
+		},
+		{
+			desc: "subcommands and args with terminator",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"open": {
+						Description: "open a file",
+						Arg: cli.StringArg{
+							Label:     "FILE",
+							Recipient: &root.parg1,
+						},
+						Strict: true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+							return nil
+						},
+						Subcommands: map[string]*cli.Command{
+							"recent": {
+								Description: "open a recent file",
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), "opening recent")
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:         []string{"test", "open", "--", "recent"},
+			wantCode:     0,
+			wantOut:      "opening \"recent\"\n",
+			wantErr:      "",
+			wantCombined: "opening \"recent\"\n",
+		},
+		{
+			desc: "subcommands and args with unexpected args",
+			entry: &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"open": {
+						Description: "open a file",
+						Arg: cli.StringArg{
+							Label:     "FILE",
+							Recipient: &root.parg1,
+						},
+						Strict: true,
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+							return nil
+						},
+						Subcommands: map[string]*cli.Command{
+							"recent": {
+								Description: "open a recent file",
+								Exec: func(prg cli.Program) error {
+									fmt.Fprintln(prg.Stdout(), "opening recent")
+									return nil
+								},
+							},
+						},
+					},
+				},
+			},
+			args:     []string{"test", "open", "a", "b"},
+			wantCode: 2,
+			wantOut:  "",
+			wantErr: `test: unexpected argument: "b"
+
+USAGE:
+    test open [OPTIONS] [COMMAND]
+    test open [OPTIONS] [--] [FILE]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    recent    open a recent file
+`,
+			wantCombined: `test: unexpected argument: "b"
+
+USAGE:
+    test open [OPTIONS] [COMMAND]
+    test open [OPTIONS] [--] [FILE]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    recent    open a recent file
+`,
+		},
+		{
+			desc: "subcommands and args with default subcommand help",
+			entry: &cli.Command{
+				Arg:               cli.StringArg{Label: "FILE", Recipient: &root.parg1},
+				DefaultSubcommand: "recent",
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+					return nil
+				},
+				Subcommands: map[string]*cli.Command{
+					"recent": {
+						Description: "open a recent file",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "opening recent")
+							return nil
+						},
+					},
+				},
+			},
+			args:     []string{"test", "-h"},
+			wantCode: 0,
+			wantOut: `USAGE:
+    test [OPTIONS] [COMMAND]
+    test [OPTIONS] [--] [FILE]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    recent    open a recent file (default)
+`,
+			wantErr: "",
+			wantCombined: `USAGE:
+    test [OPTIONS] [COMMAND]
+    test [OPTIONS] [--] [FILE]
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    recent    open a recent file (default)
+`,
+		},
+		{
+			desc: "subcommands and args with default subcommand",
+			entry: &cli.Command{
+				Arg:               cli.StringArg{Label: "FILE", Recipient: &root.parg1},
+				DefaultSubcommand: "recent",
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+					return nil
+				},
+				Subcommands: map[string]*cli.Command{
+					"recent": {
+						Description: "open a recent file",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "opening recent")
+							return nil
+						},
+					},
+				},
+			},
+			args:         []string{"test"},
+			wantCode:     0,
+			wantOut:      "opening recent\n",
+			wantErr:      "",
+			wantCombined: "opening recent\n",
+		},
+		{
+			desc: "subcommands and args with default subcommand and arg",
+			entry: &cli.Command{
+				Arg:               cli.StringArg{Label: "FILE", Recipient: &root.parg1},
+				DefaultSubcommand: "recent",
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintf(prg.Stdout(), "opening %q\n", root.parg1)
+					return nil
+				},
+				Subcommands: map[string]*cli.Command{
+					"recent": {
+						Description: "open a recent file",
+						Exec: func(prg cli.Program) error {
+							fmt.Fprintln(prg.Stdout(), "opening recent")
+							return nil
+						},
 					},
 				},
 			},
-			args:     []string{"test", "-h"},
-			wantCode: 0,
-			wantOut: `USAGE:
-    test [OPTIONS]
-
-OPTIONS:
-    -b, -bool <TRUE|FALSE>        pass a boolean here
-        -dull                     just a dull option
-    -h, -help                     print help information
-    -i, -int <NUMBER>             pass an integer here
-    -I, -int64 <64-BIT NUMBER>    pass a 64-bit integer here
-    -s, -string <TEXT>            pass a string here (default: "bar")
-`,
-			wantErr: "",
-			wantCombined: `USAGE:
-    test [OPTIONS]
-
-OPTIONS:
-    -b, -bool <TRUE|FALSE>        pass a boolean here
-        -dull                     just a dull option
-    -h, -help                     print help information
-    -i, -int <NUMBER>             pass an integer here
-    -I, -int64 <64-BIT NUMBER>    pass a 64-bit integer here
-    -s, -string <TEXT>            pass a string here (default: "bar")
-`,
+			args:         []string{"test", "notes.txt"},
+			wantCode:     0,
+			wantOut:      "opening \"notes.txt\"\n",
+			wantErr:      "",
+			wantCombined: "opening \"notes.txt\"\n",
 		},
 		{
 			desc: "subcommand misuse",
@@ -1148,7 +3318,642 @@ COMMANDS:
 	})
 }
 
+func testCommandLineProgram(t *testing.T) {
+	t.Run("Program", func(t *testing.T) {
+		var (
+			name   string
+			stdout strings.Builder
+		)
+		entry := &cli.Command{
+			Subcommands: map[string]*cli.Command{
+				"cat": {
+					Arg: cli.StringArg{
+						Label:     "NAME",
+						Recipient: &name,
+					},
+					Exec: func(prg cli.Program) error {
+						b, err := ioutil.ReadAll(prg.Stdin())
+						if err != nil {
+							return err
+						}
+						foo, _ := prg.LookupEnv("FOO")
+						_, ok := prg.LookupEnv("BAR")
+						fmt.Fprintf(prg.Stdout(), "%s %q %q %s %s %t %s", name, prg.RawArgs(), prg.Args(), b, foo, ok, prg.Dir())
+						return nil
+					},
+				},
+			},
+		}
+		cli := cli.New(
+			entry,
+			cli.Stdin(strings.NewReader("foo bar")),
+			cli.Stdout(&stdout),
+			cli.Env([]string{"FOO=foo", "FOO=baz"}),
+			cli.Dir("/foo"),
+		)
+		code := cli.ParseAndRun([]string{"/bin/test", "cat", "baz", "qux"})
+		if want, got := 0, code; got != want {
+			t.Fatalf("want %d, got %d", want, got)
+		}
+		want := `baz ["/bin/test" "cat" "baz" "qux"] ["qux"] foo bar baz false /foo`
+		if got := stdout.String(); got != want {
+			t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+}
+
+func testCommandLineOutput(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		opts      []func(*cli.CLI)
+		flush     bool
+		wantEarly string
+	}{
+		{
+			desc:      "buffered",
+			wantEarly: "",
+		},
+		{
+			desc:      "buffered with flush",
+			flush:     true,
+			wantEarly: "foo\n",
+		},
+		{
+			desc: "stream",
+			opts: []func(*cli.CLI){
+				cli.Stream(true),
+			},
+			wantEarly: "foo\n",
+		},
+	}
+	t.Run("Output", func(t *testing.T) {
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				var combined strings.Builder
+				entry := &cli.Command{
+					Exec: func(prg cli.Program) error {
+						fmt.Fprintln(prg.Stdout(), "foo")
+						if tc.flush {
+							if err := prg.Flush(); err != nil {
+								return err
+							}
+						}
+						if want, got := tc.wantEarly, combined.String(); got != want {
+							t.Errorf("output while running (-want +got):\n%s", cmp.Diff(want, got))
+						}
+						fmt.Fprintln(prg.Stderr(), "bar")
+						return nil
+					},
+				}
+				opts := []func(*cli.CLI){
+					cli.Stdout(&combined),
+					cli.Stderr(&combined),
+				}
+				cli := cli.New(entry, append(opts, tc.opts...)...)
+				code := cli.ParseAndRun([]string{"test"})
+				if want, got := 0, code; got != want {
+					t.Fatalf("want %d, got %d", want, got)
+				}
+				if want, got := "foo\nbar\n", combined.String(); got != want {
+					t.Fatalf("STDOUT + STDERR (-want +got):\n%s", cmp.Diff(want, got))
+				}
+			})
+		}
+	})
+	t.Run("Output concurrently", func(t *testing.T) {
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				const (
+					nroutines = 8
+					nwrites   = 100
+				)
+				var combined strings.Builder
+				entry := &cli.Command{
+					Exec: func(prg cli.Program) error {
+						var wg sync.WaitGroup
+						for i := 0; i < nroutines; i++ {
+							wg.Add(1)
+							go func(i int) {
+								defer wg.Done()
+								for j := 0; j < nwrites; j++ {
+									w := prg.Stdout()
+									if j%2 == 1 {
+										w = prg.Stderr()
+									}
+									fmt.Fprintf(w, "goroutine %d: write %d\n", i, j)
+									if tc.flush && j%10 == 0 {
+										prg.Flush()
+									}
+								}
+							}(i)
+						}
+						wg.Wait()
+						return nil
+					},
+				}
+				opts := []func(*cli.CLI){
+					cli.Stdout(&combined),
+					cli.Stderr(&combined),
+				}
+				cli := cli.New(entry, append(opts, tc.opts...)...)
+				code := cli.ParseAndRun([]string{"test"})
+				if want, got := 0, code; got != want {
+					t.Fatalf("want %d, got %d", want, got)
+				}
+				// Whole writes must be kept in order for each goroutine.
+				next := make([]int, nroutines)
+				for _, line := range strings.Split(strings.TrimSuffix(combined.String(), "\n"), "\n") {
+					var i, j int
+					if _, err := fmt.Sscanf(line, "goroutine %d: write %d", &i, &j); err != nil {
+						t.Fatalf("bad line %q: %v", line, err)
+					}
+					if want, got := next[i], j; got != want {
+						t.Fatalf("goroutine %d: want write %d, got %d", i, want, got)
+					}
+					next[i]++
+				}
+				for i, n := range next {
+					if want, got := nwrites, n; got != want {
+						t.Fatalf("goroutine %d: want %d writes, got %d", i, want, got)
+					}
+				}
+			})
+		}
+	})
+}
+
+func testCommandLineReentrancy(t *testing.T) {
+	t.Run("ParseAndRun many times", func(t *testing.T) {
+		var name string
+		entry := &cli.Command{
+			Arg: cli.StringArg{
+				Label:     "NAME",
+				Required:  true,
+				Recipient: &name,
+			},
+			Exec: func(prg cli.Program) error {
+				fmt.Fprintf(prg.Stdout(), "%s: %s\n", prg.Name(), name)
+				return nil
+			},
+		}
+		var stdout strings.Builder
+		cli := cli.New(entry, cli.Stdout(&stdout), cli.HelpDescription("print help information"))
+		cli.ParseAndRun([]string{"foo", "bar"})
+		cli.ParseAndRun([]string{"baz", "-h"})
+		cli.ParseAndRun([]string{"qux", "quux"})
+		want := `foo: bar
+USAGE:
+    baz [OPTIONS] [--] <NAME>
+
+OPTIONS:
+    -h, -help    print help information
+qux: quux
+`
+		if got := stdout.String(); got != want {
+			t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+		}
+		if want, got := 0, len(entry.Options); got != want {
+			t.Fatalf("want %d, got %d", want, got)
+		}
+	})
+	t.Run("ParseAndRun many times with optional args", func(t *testing.T) {
+		var (
+			name string
+			rest []string
+		)
+		entry := &cli.Command{
+			Arg: cli.StringArg{
+				Label:     "NAME",
+				Recipient: &name,
+				Next: cli.RepeatingArg{
+					Label:     "REST",
+					Recipient: &rest,
+				},
+			},
+			Exec: func(prg cli.Program) error {
+				fmt.Fprintf(prg.Stdout(), "%q %q\n", name, rest)
+				return nil
+			},
+		}
+		var stdout strings.Builder
+		cli := cli.New(entry, cli.Stdout(&stdout))
+		cli.ParseAndRun([]string{"t", "alice", "x", "y"})
+		cli.ParseAndRun([]string{"t"})
+		cli.ParseAndRun([]string{"t", "bob"})
+		want := `"alice" ["x" "y"]
+"" []
+"bob" []
+`
+		if got := stdout.String(); got != want {
+			t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+	t.Run("ParseAndRun many times with VarOption", func(t *testing.T) {
+		var stdout strings.Builder
+		cmdl := cli.NewFunc(func() *cli.Command {
+			var modes cliutil.CommaSepOptionSet
+			return &cli.Command{
+				Options: map[string]cli.Option{
+					"modes": cli.VarOption{Recipient: &modes},
+				},
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintf(prg.Stdout(), "%q\n", modes.String())
+					return nil
+				},
+			}
+		}, cli.Stdout(&stdout))
+		cmdl.ParseAndRun([]string{"t", "-modes", "a,b"})
+		cmdl.ParseAndRun([]string{"t"})
+		want := `"a,b"
+""
+`
+		if got := stdout.String(); got != want {
+			t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+	t.Run("ParseAndRun concurrently", func(t *testing.T) {
+		var mu sync.Mutex
+		ran := make(map[string]bool)
+		cli := cli.NewFunc(func() *cli.Command {
+			var name string
+			return &cli.Command{
+				Subcommands: map[string]*cli.Command{
+					"hello": {
+						Arg: cli.StringArg{
+							Label:     "NAME",
+							Required:  true,
+							Recipient: &name,
+						},
+						Exec: func(prg cli.Program) error {
+							mu.Lock()
+							defer mu.Unlock()
+							ran[name] = true
+							return nil
+						},
+					},
+				},
+			}
+		})
+		const n = 16
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if code := cli.ParseAndRun([]string{"test", "hello", fmt.Sprint(i)}); code != 0 {
+					t.Errorf("want %d, got %d", 0, code)
+				}
+			}(i)
+		}
+		wg.Wait()
+		for i := 0; i < n; i++ {
+			if !ran[fmt.Sprint(i)] {
+				t.Errorf("missing run for %d", i)
+			}
+		}
+	})
+}
+
+func testCommandLineInvoke(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		args     []string
+		wantCode int
+		wantErr  error
+		wantOut  string
+		wantErrw string
+	}{
+		{
+			desc:     "success",
+			args:     []string{"test", "echo", "foo"},
+			wantCode: 0,
+			wantErr:  nil,
+			wantOut:  "foo bar /tmp\n",
+			wantErrw: "",
+		},
+		{
+			desc:     "exec error",
+			args:     []string{"test", "fail"},
+			wantCode: 1,
+			wantErr:  errors.New("failed"),
+			wantOut:  "",
+			wantErrw: "test: failed\n",
+		},
+		{
+			desc:     "misuse",
+			args:     []string{"test", "foo"},
+			wantCode: 2,
+			wantErr:  errors.New("command provided but not defined: foo"),
+			wantOut:  "",
+			wantErrw: `test: command provided but not defined: foo
+
+USAGE:
+    test [OPTIONS] <COMMAND>
+
+OPTIONS:
+    -h, -help    print help information
+
+COMMANDS:
+    echo
+    fail
+`,
+		},
+	}
+	t.Run("Invoke", func(t *testing.T) {
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				var (
+					defaultOut     strings.Builder
+					stdout, stderr strings.Builder
+				)
+				cmdl := cli.New(&cli.Command{
+					Subcommands: map[string]*cli.Command{
+						"echo": {
+							Exec: func(prg cli.Program) error {
+								b, err := ioutil.ReadAll(prg.Stdin())
+								if err != nil {
+									return err
+								}
+								fmt.Fprintln(prg.Stdout(), string(b), prg.Getenv("FOO"), prg.Dir())
+								return nil
+							},
+						},
+						"fail": {
+							Exec: func(prg cli.Program) error {
+								return errors.New("failed")
+							},
+						},
+					},
+				},
+					cli.Stdout(&defaultOut),
+					cli.Stderr(&defaultOut),
+					cli.HelpDescription("print help information"),
+				)
+				code, err := cmdl.Invoke(context.Background(), cli.Invocation{
+					Args:   tc.args,
+					Stdin:  strings.NewReader("foo"),
+					Stdout: &stdout,
+					Stderr: &stderr,
+					Env:    []string{"FOO=bar"},
+					Dir:    "/tmp",
+				})
+				if want, got := tc.wantCode, code; got != want {
+					t.Fatalf("want %d, got %d", want, got)
+				}
+				if want, got := tc.wantErr, err; fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Fatalf("want %v, got %v", want, got)
+				}
+				if want, got := tc.wantCode == 2, errors.Is(err, cli.ErrMisuse); got != want {
+					t.Fatalf("want %t, got %t", want, got)
+				}
+				if want, got := tc.wantOut, stdout.String(); got != want {
+					t.Fatalf("STDOUT (-want +got):\n%s", cmp.Diff(want, got))
+				}
+				if want, got := tc.wantErrw, stderr.String(); got != want {
+					t.Fatalf("STDERR (-want +got):\n%s", cmp.Diff(want, got))
+				}
+				if want, got := "", defaultOut.String(); got != want {
+					t.Fatalf("default outputs (-want +got):\n%s", cmp.Diff(want, got))
+				}
+			})
+		}
+	})
+}
+
+func testCommandLineRun(t *testing.T) {
+	entry := &cli.Command{
+		Subcommands: map[string]*cli.Command{
+			"remote": {
+				Subcommands: map[string]*cli.Command{
+					"add": {
+						Arg: cli.StringArg{
+							Label:     "NAME",
+							Required:  true,
+							Recipient: newDullStr(),
+						},
+						Exec: func(prg cli.Program) error {
+							return errors.New("failed")
+						},
+					},
+				},
+			},
+		},
+	}
+	testCases := []struct {
+		desc      string
+		args      []string
+		cancelCtx bool
+		check     func(*testing.T, error)
+	}{
+		{
+			desc: "usage error",
+			args: []string{"test", "remote", "add"},
+			check: func(t *testing.T, err error) {
+				var usageErr *cli.UsageError
+				if !errors.As(err, &usageErr) {
+					t.Fatalf("want %T, got %T", usageErr, err)
+				}
+				if want, got := []string{"test", "remote", "add"}, usageErr.Path; !cmp.Equal(got, want) {
+					t.Fatalf("UsageError.Path mismatch (-want +got):\n%s", cmp.Diff(want, got))
+				}
+				if want, got := "missing required argument: NAME", err.Error(); got != want {
+					t.Fatalf("want %q, got %q", want, got)
+				}
+				if !errors.Is(err, cli.ErrMisuse) {
+					t.Fatalf("want %v to match %v", err, cli.ErrMisuse)
+				}
+				var w strings.Builder
+				usageErr.WriteUsage(&w)
+				want := `USAGE:
+    test remote add [OPTIONS] [--] <NAME>
+
+OPTIONS:
+    -h, -help    Print this help message.
+`
+				if got := w.String(); got != want {
+					t.Fatalf("UsageError.WriteUsage mismatch (-want +got):\n%s", cmp.Diff(want, got))
+				}
+			},
+		},
+		{
+			desc: "unknown command",
+			args: []string{"test", "remote", "rm"},
+			check: func(t *testing.T, err error) {
+				var unknownErr *cli.UnknownCommandError
+				if !errors.As(err, &unknownErr) {
+					t.Fatalf("want %T, got %T", unknownErr, err)
+				}
+				if want, got := "rm", unknownErr.Name; got != want {
+					t.Fatalf("want %q, got %q", want, got)
+				}
+				var usageErr *cli.UsageError
+				if !errors.As(err, &usageErr) {
+					t.Fatalf("want %T, got %T", usageErr, err)
+				}
+				if want, got := []string{"test", "remote"}, usageErr.Path; !cmp.Equal(got, want) {
+					t.Fatalf("UsageError.Path mismatch (-want +got):\n%s", cmp.Diff(want, got))
+				}
+			},
+		},
+		{
+			desc: "bad option",
+			args: []string{"test", "-foo"},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, cli.ErrMisuse) {
+					t.Fatalf("want %v to match %v", err, cli.ErrMisuse)
+				}
+				if want, got := "flag provided but not defined: -foo", err.Error(); got != want {
+					t.Fatalf("want %q, got %q", want, got)
+				}
+			},
+		},
+		{
+			desc: "help requested",
+			args: []string{"test", "remote", "-h"},
+			check: func(t *testing.T, err error) {
+				var helpErr *cli.HelpError
+				if !errors.As(err, &helpErr) {
+					t.Fatalf("want %T, got %T", helpErr, err)
+				}
+				if want, got := []string{"test", "remote"}, helpErr.Path; !cmp.Equal(got, want) {
+					t.Fatalf("HelpError.Path mismatch (-want +got):\n%s", cmp.Diff(want, got))
+				}
+				if !errors.Is(err, cli.ErrHelp) {
+					t.Fatalf("want %v to match %v", err, cli.ErrHelp)
+				}
+			},
+		},
+		{
+			desc: "command without exec",
+			args: []string{"test"},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, cli.ErrHelp) {
+					t.Fatalf("want %v to match %v", err, cli.ErrHelp)
+				}
+			},
+		},
+		{
+			desc: "exec error",
+			args: []string{"test", "remote", "add", "origin"},
+			check: func(t *testing.T, err error) {
+				var execErr *cli.ExecError
+				if !errors.As(err, &execErr) {
+					t.Fatalf("want %T, got %T", execErr, err)
+				}
+				if want, got := []string{"test", "remote", "add"}, execErr.Path; !cmp.Equal(got, want) {
+					t.Fatalf("ExecError.Path mismatch (-want +got):\n%s", cmp.Diff(want, got))
+				}
+				if want, got := "failed", err.Error(); got != want {
+					t.Fatalf("want %q, got %q", want, got)
+				}
+			},
+		},
+		{
+			desc:      "context canceled",
+			args:      []string{"test", "remote", "add", "origin"},
+			cancelCtx: true,
+			check: func(t *testing.T, err error) {
+				if want, got := context.Canceled, err; got != want {
+					t.Fatalf("want %v, got %v", want, got)
+				}
+			},
+		},
+	}
+	t.Run("Run", func(t *testing.T) {
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				var combined strings.Builder
+				cmdl := cli.New(entry, cli.Stdout(&combined), cli.Stderr(&combined))
+				ctx := context.Background()
+				if tc.cancelCtx {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithCancel(ctx)
+					cancel()
+				}
+				tc.check(t, cmdl.Run(ctx, tc.args))
+				if want, got := "", combined.String(); got != want {
+					t.Fatalf("STDOUT + STDERR (-want +got):\n%s", cmp.Diff(want, got))
+				}
+			})
+		}
+	})
+}
+
 func newDullStr() *string {
 	var s string
 	return &s
 }
+
+func testCommandLineShortNames(t *testing.T) {
+	t.Run("ShortNames", func(t *testing.T) {
+		newEntry := func(shorts ...rune) *cli.Command {
+			var n int
+			opts := make([]cli.NamedOption, len(shorts))
+			for i, r := range shorts {
+				opts[i] = cli.NamedOption{
+					Name: fmt.Sprintf("opt%d", i),
+					Option: cli.CountOption{
+						OptionDetails: cli.OptionDetails{Description: "count things", Short: r},
+						Recipient:     &n,
+					},
+				}
+			}
+			return &cli.Command{
+				OrderedOptions: opts,
+				Exec: func(prg cli.Program) error {
+					fmt.Fprintln(prg.Stdout(), n)
+					return nil
+				},
+			}
+		}
+		t.Run("unicode", func(t *testing.T) {
+			var stdout strings.Builder
+			cmdl := cli.New(newEntry('ü', 'λ'), cli.Stdout(&stdout))
+			if code := cmdl.ParseAndRun([]string{"test", "-ü", "-λ", "-opt0"}); code != 0 {
+				t.Fatalf("want 0, got %d", code)
+			}
+			if want, got := "3\n", stdout.String(); got != want {
+				t.Fatalf("want %q, got %q", want, got)
+			}
+			stdout.Reset()
+			cmdl.ParseAndRun([]string{"test", "-h"})
+			want := `USAGE:
+    test [OPTIONS]
+
+OPTIONS:
+    -ü, -opt0    count things (repeatable)
+    -λ, -opt1    count things (repeatable)
+    -h, -help    Print this help message.
+`
+			if got := stdout.String(); got != want {
+				t.Fatalf("help mismatch (-want +got):\n%s", cmp.Diff(want, got))
+			}
+		})
+		invalid := []struct {
+			desc   string
+			shorts []rune
+			want   string
+		}{
+			{"duplicate", []rune{'x', 'x'}, `cli: short name "x" of option -opt1 is already defined`},
+			{"help", []rune{'h'}, `cli: short name "h" of option -opt0 is already defined`},
+			{"non-printable", []rune{'\x7f'}, `cli: invalid short name "\x7f" for option -opt0`},
+			{"space", []rune{' '}, `cli: invalid short name " " for option -opt0`},
+			{"dash", []rune{'-'}, `cli: invalid short name "-" for option -opt0`},
+		}
+		for _, tc := range invalid {
+			t.Run(tc.desc, func(t *testing.T) {
+				defer func() {
+					r := recover()
+					err, ok := r.(error)
+					if !ok {
+						t.Fatalf("want panic with error, got %v", r)
+					}
+					if got := err.Error(); got != tc.want {
+						t.Fatalf("want %q, got %q", tc.want, got)
+					}
+				}()
+				cli.New(newEntry(tc.shorts...), cli.Stdout(ioutil.Discard)).ParseAndRun([]string{"test"})
+			})
+		}
+	})
+}
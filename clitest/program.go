@@ -3,6 +3,7 @@ package clitest
 import (
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/gbrlsnchs/cli"
 )
@@ -11,35 +12,142 @@ var _ cli.Program = Program{}
 var _ cli.Program = new(Program)
 
 // Program is a stub program that implements cli.Program.
+// Its writers are safe for concurrent use.
 type Program struct {
+	mu     *sync.Mutex
 	name   string
+	path   []string
+	args   []string
+	rest   []string
+	env    []string
+	dir    string
+	in     io.Reader
 	comb   *strings.Builder
 	out    *strings.Builder
 	errout *strings.Builder
 }
 
 // NewProgram returns a new stub program.
-func NewProgram(name string) Program {
+// Optionally, a subcommand path that follows the program's name can be set.
+func NewProgram(name string, path ...string) Program {
 	comb := new(strings.Builder)
 	out := new(strings.Builder)
 	errw := new(strings.Builder)
-	return Program{name, comb, out, errw}
+	path = append([]string{name}, path...)
+	return Program{
+		mu:     new(sync.Mutex),
+		name:   name,
+		path:   path,
+		args:   []string{name},
+		in:     strings.NewReader(""),
+		comb:   comb,
+		out:    out,
+		errout: errw,
+	}
+}
+
+// WithStdin returns a copy of the program that reads s from its stdin.
+func (p Program) WithStdin(s string) Program {
+	p.in = strings.NewReader(s)
+	return p
+}
+
+// WithRawArgs returns a copy of the program with args as its raw argument vector.
+func (p Program) WithRawArgs(args ...string) Program {
+	p.args = args
+	return p
+}
+
+// WithEnv returns a copy of the program with environ as its environment,
+// which is in the same "key=value" form as os.Environ.
+func (p Program) WithEnv(environ ...string) Program {
+	p.env = environ
+	return p
+}
+
+// WithDir returns a copy of the program with dir as its working directory.
+func (p Program) WithDir(dir string) Program {
+	p.dir = dir
+	return p
+}
+
+// WithArgs returns a copy of the program with args as its remaining positional arguments.
+func (p Program) WithArgs(args ...string) Program {
+	p.rest = args
+	return p
 }
 
 // Name returns the program's name.
 func (p Program) Name() string { return p.name }
 
+// Path returns the program's name followed by its subcommand path.
+func (p Program) Path() []string { return append([]string(nil), p.path...) }
+
+// RawArgs returns the program's raw argument vector.
+// The default is a single argument with the program's name.
+func (p Program) RawArgs() []string { return append([]string(nil), p.args...) }
+
+// Args returns the program's remaining positional arguments.
+func (p Program) Args() []string { return append([]string(nil), p.rest...) }
+
+// Stdin returns the program's stdin.
+func (p Program) Stdin() io.Reader { return p.in }
+
 // Stdout returns the program's stdout.
-func (p Program) Stdout() io.Writer { return io.MultiWriter(p.out, p.comb) }
+func (p Program) Stdout() io.Writer { return &lockedWriter{p.mu, io.MultiWriter(p.out, p.comb)} }
 
 // Stderr returns the program's stderr.
-func (p Program) Stderr() io.Writer { return io.MultiWriter(p.errout, p.comb) }
+func (p Program) Stderr() io.Writer { return &lockedWriter{p.mu, io.MultiWriter(p.errout, p.comb)} }
+
+// Flush does nothing, since a stub program's output is never buffered.
+func (p Program) Flush() error { return nil }
+
+// Getenv returns the value of an environment variable.
+func (p Program) Getenv(key string) string {
+	v, _ := p.LookupEnv(key)
+	return v
+}
+
+// LookupEnv returns the value of an environment variable and whether it is set.
+// Unlike a real program, a stub program's environment is empty unless set with WithEnv.
+func (p Program) LookupEnv(key string) (string, bool) {
+	prefix := key + "="
+	for i := len(p.env) - 1; i >= 0; i-- {
+		if kv := p.env[i]; strings.HasPrefix(kv, prefix) {
+			return kv[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// Environ returns a copy of the program's environment.
+func (p Program) Environ() []string { return append([]string(nil), p.env...) }
+
+// Dir returns the program's working directory, which is empty unless set with WithDir.
+func (p Program) Dir() string { return p.dir }
 
 // Output returns what has been written to standard output.
-func (p Program) Output() string { return p.out.String() }
+func (p Program) Output() string { return p.read(p.out) }
 
 // ErrOutput returns what has been written to standard error.
-func (p Program) ErrOutput() string { return p.errout.String() }
+func (p Program) ErrOutput() string { return p.read(p.errout) }
 
 // CombinedOutput returns what has been written to both standard output and error.
-func (p Program) CombinedOutput() string { return p.comb.String() }
+func (p Program) CombinedOutput() string { return p.read(p.comb) }
+
+func (p Program) read(sb *strings.Builder) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sb.String()
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(b)
+}
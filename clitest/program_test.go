@@ -3,6 +3,9 @@ package clitest_test
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gbrlsnchs/cli/clitest"
@@ -16,6 +19,77 @@ func TestProgram(t *testing.T) {
 			t.Fatalf("want %q, got %q", want, got)
 		}
 	})
+	t.Run("Stdin", func(t *testing.T) {
+		prg := clitest.NewProgram("test").WithStdin("foo")
+		b, err := ioutil.ReadAll(prg.Stdin())
+		if want, got := (error)(nil), err; got != want {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+		if want, got := "foo", string(b); got != want {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	})
+	t.Run("Args", func(t *testing.T) {
+		prg := clitest.NewProgram("test").WithRawArgs("test", "foo", "bar").WithArgs("bar")
+		if want, got := []string{"test", "foo", "bar"}, prg.RawArgs(); !cmp.Equal(got, want) {
+			t.Fatalf("Program.RawArgs mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+		if want, got := []string{"bar"}, prg.Args(); !cmp.Equal(got, want) {
+			t.Fatalf("Program.Args mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+	t.Run("Env", func(t *testing.T) {
+		prg := clitest.NewProgram("test").WithEnv("FOO=bar", "BAZ=", "FOO=qux")
+		if want, got := "qux", prg.Getenv("FOO"); got != want {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+		if v, ok := prg.LookupEnv("BAZ"); v != "" || !ok {
+			t.Fatalf("want (%q, %t), got (%q, %t)", "", true, v, ok)
+		}
+		if v, ok := prg.LookupEnv("QUX"); v != "" || ok {
+			t.Fatalf("want (%q, %t), got (%q, %t)", "", false, v, ok)
+		}
+		if want, got := []string{"FOO=bar", "BAZ=", "FOO=qux"}, prg.Environ(); !cmp.Equal(got, want) {
+			t.Fatalf("Program.Environ mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+	t.Run("Dir", func(t *testing.T) {
+		prg := clitest.NewProgram("test").WithDir("/tmp")
+		if want, got := "/tmp", prg.Dir(); got != want {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	})
+	t.Run("Path", func(t *testing.T) {
+		prg := clitest.NewProgram("test", "remote", "add")
+		if want, got := []string{"test", "remote", "add"}, prg.Path(); !cmp.Equal(got, want) {
+			t.Fatalf("Program.Path mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		prg := clitest.NewProgram("test")
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					fmt.Fprintln(prg.Stdout(), "foo")
+					fmt.Fprintln(prg.Stderr(), "bar")
+				}
+			}()
+		}
+		wg.Wait()
+		if want, got := strings.Repeat("foo\n", 800), prg.Output(); got != want {
+			t.Fatalf("Program.Output mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+		if want, got := strings.Repeat("bar\n", 800), prg.ErrOutput(); got != want {
+			t.Fatalf("Program.ErrOutput mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+		if want, got := 1600, strings.Count(prg.CombinedOutput(), "\n"); got != want {
+			t.Fatalf("want %d, got %d", want, got)
+		}
+	})
 
 	type output int
 	const (
@@ -16,16 +16,130 @@ type ExecFunc func(Program) error
 // If a command doesn't have an Exec function, it is treated as a help command,
 // which prints help to stdout.
 //
-// When a command has one or more subcommands, its Arg will be totally ignored.
+// When a command has one or more subcommands, its Arg is only used when it has an Exec
+// function as well, in which case a first positional argument that doesn't name any of
+// its subcommands is parsed by Arg instead of being reported as an unknown command,
+// e.g. "tool open recent" runs a subcommand, while "tool open notes.txt" runs "open" itself.
+// Otherwise, its Arg will be totally ignored.
+//
+// Options are parsed until either the first positional argument or the "--" terminator
+// is found, whichever comes first. Everything after the terminator is positional, even
+// subcommand names and arguments starting with a dash, like negative numbers. Note that
+// only the first "--" before positional arguments is a terminator, any "--" after them is
+// a regular positional argument.
+//
+// By default, positional arguments that are not consumed by Arg are ignored.
+// When Strict is set, they are reported as a misuse of the command instead.
+//
+// Options and subcommands declared in maps are listed in help sorted by name.
+// In order to list them in a specific order, they can be declared in OrderedOptions
+// and OrderedSubcommands, which are listed first, in the order they are declared.
+//
+// When DefaultSubcommand is set, the subcommand it names is run when no subcommand is given,
+// along with the options that the command itself doesn't define and all of the arguments,
+// e.g. "tool -short" runs as "tool status -short" when the default subcommand is "status".
+// When the default subcommand has an Arg, a first argument that doesn't name a subcommand
+// is passed to it as well, e.g. "tool notes.txt" runs as "tool status notes.txt".
+// Otherwise, it is reported as an unknown command. It takes precedence over
+// the command's own Exec, which then only runs for arguments that don't name a subcommand
+// when the command has an Arg, or for arguments after the "--" terminator.
+//
+// When Category is set, the command is listed in its parent's help message under its
+// own section, titled after the category. Categories are listed in the order they first
+// appear, after the commands without a category.
+//
+// When Hidden is set, the command is not listed in its parent's help message,
+// but it can still be run.
+//
+// When Deprecated is set, the command is marked as deprecated in its parent's help message
+// and a warning is printed to stderr when it is run.
 type Command struct {
-	Description string              // Description describes what the command does.
-	Exec        ExecFunc            // Exec is the function run by the command.
-	Options     map[string]Option   // Options are the command's options (also known as flags).
-	Subcommands map[string]*Command // Subcommands store the command's subcommands.
-	Arg         Arg                 // Arg is a positional argument.
+	Description        string              // Description describes what the command does.
+	Category           string              // Category groups the command in its parent's help.
+	Exec               ExecFunc            // Exec is the function run by the command.
+	Options            map[string]Option   // Options are the command's options (also known as flags).
+	OrderedOptions     []NamedOption       // OrderedOptions are options listed in declaration order.
+	Subcommands        map[string]*Command // Subcommands store the command's subcommands.
+	OrderedSubcommands []NamedCommand      // OrderedSubcommands are subcommands listed in declaration order.
+	DefaultSubcommand  string              // DefaultSubcommand is run when no subcommand is given.
+	Arg                Arg                 // Arg is a positional argument.
+	Strict             bool                // Strict rejects unexpected positional arguments.
+	Hidden             bool                // Hidden omits the command from its parent's help.
+	Deprecated         *Deprecation        // Deprecated marks the command as deprecated.
+}
+
+// NamedOption is an option along with its name.
+type NamedOption struct {
+	Name   string
+	Option Option
+}
+
+// NamedCommand is a command along with its name.
+type NamedCommand struct {
+	Name    string
+	Command *Command
+}
+
+// options returns all of the command's options in the order they are listed in help,
+// where extra options take the place of the ones with the same name declared in Options.
+func (c *Command) options(extra ...NamedOption) []NamedOption {
+	replaced := func(name string) bool {
+		for _, e := range extra {
+			if e.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	opts := make([]NamedOption, 0, len(c.OrderedOptions)+len(c.Options)+len(extra))
+	for _, o := range c.OrderedOptions {
+		if !replaced(o.Name) {
+			opts = append(opts, o)
+		}
+	}
+	sorted := append([]NamedOption(nil), extra...)
+	for name, o := range c.Options {
+		if !replaced(name) {
+			sorted = append(sorted, NamedOption{name, o})
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return append(opts, sorted...)
 }
 
-func (c *Command) writeUsage(w io.Writer, name string, showDesc bool) {
+// subcommands returns all of the command's subcommands in the order they are listed in help.
+func (c *Command) subcommands() []NamedCommand {
+	cmds := make([]NamedCommand, 0, len(c.OrderedSubcommands)+len(c.Subcommands))
+	cmds = append(cmds, c.OrderedSubcommands...)
+	sorted := make([]NamedCommand, 0, len(c.Subcommands))
+	for name, sub := range c.Subcommands {
+		sorted = append(sorted, NamedCommand{name, sub})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return append(cmds, sorted...)
+}
+
+func (c *Command) subcommand(name string) (*Command, bool) {
+	for _, nc := range c.OrderedSubcommands {
+		if nc.Name == name {
+			return nc.Command, true
+		}
+	}
+	sub, ok := c.Subcommands[name]
+	return sub, ok
+}
+
+func (c *Command) hasSubcommands() bool {
+	return len(c.OrderedSubcommands) > 0 || len(c.Subcommands) > 0
+}
+
+// takesArg reports whether c's Arg is used, which is not the case
+// for commands that have subcommands but no Exec function.
+func (c *Command) takesArg() bool {
+	return c.Arg != nil && (c.Exec != nil || !c.hasSubcommands())
+}
+
+func (c *Command) writeUsage(w io.Writer, name string, help Option, showDesc, showHidden bool) {
 	// DESCRIPTION
 	if showDesc && c.Description != "" {
 		wrapWrite(w, c.Description)
@@ -33,55 +147,178 @@ func (c *Command) writeUsage(w io.Writer, name string, showDesc bool) {
 	}
 	// USAGE (A.K.A. SUMMARY)
 	fmt.Fprintln(w, "USAGE:")
-	fmt.Fprintf(w, "\t%s [OPTIONS]", name)
-	nsub := len(c.Subcommands)
-	if nsub > 0 {
-		fmt.Fprint(w, " ")
+	// Hidden commands are left out of the synopsis as well, so they are not hinted at.
+	subs := c.subcommands()
+	if !showHidden {
+		visible := subs[:0:0]
+		for _, sub := range subs {
+			if !sub.Command.Hidden {
+				visible = append(visible, sub)
+			}
+		}
+		subs = visible
+	}
+	takesArg := c.takesArg()
+	if len(subs) > 0 {
 		cstart, cend := "<", ">"
-		if c.Exec != nil {
+		if c.Exec != nil || c.DefaultSubcommand != "" {
 			cstart, cend = "[", "]"
 		}
-		fmt.Fprintf(w, "%sCOMMAND%s", cstart, cend)
-	} else if arg := c.Arg; arg != nil {
-		arg.WriteDoc(w)
+		fmt.Fprintf(w, "\t%s [OPTIONS] %sCOMMAND%s\n", name, cstart, cend)
 	}
-	fmt.Fprint(w, "\n\nOPTIONS:\n") // this is always printed, since help option is always present
-	// OPTIONS
-	copts := c.Options
-	optl := make([]string, 0, len(copts))
-	for name := range copts {
-		optl = append(optl, name)
-	}
-	sort.Strings(optl)
-	for _, o := range optl {
-		fmt.Fprint(w, "\t")
-		copts[o].WriteDoc(w, o)
+	// Commands that take arguments along with subcommands have both forms listed.
+	if len(subs) == 0 || takesArg {
+		fmt.Fprintf(w, "\t%s [OPTIONS]", name)
+		if takesArg {
+			fmt.Fprint(w, " [--]")
+			c.Arg.WriteDoc(w)
+		}
 		fmt.Fprintln(w)
 	}
+	// OPTIONS
+	opts := c.options(NamedOption{"help", help})
+	if !showHidden {
+		visible := opts[:0:0]
+		for _, o := range opts {
+			if !optionDetails(o.Option).Hidden {
+				visible = append(visible, o)
+			}
+		}
+		opts = visible
+	}
+	for _, g := range groupOptions(opts) {
+		fmt.Fprintf(w, "\n%s:\n", g.title)
+		for _, o := range g.opts {
+			fmt.Fprint(w, "\t")
+			o.Option.WriteDoc(w, o.Name)
+			fmt.Fprintln(w)
+		}
+	}
 	// COMMANDS
-	if nsub > 0 {
-		fmt.Fprint(w, "\nCOMMANDS:\n")
-		ccmds := c.Subcommands
-		subl := make([]string, 0, nsub)
-		for name := range ccmds {
-			subl = append(subl, name)
-		}
-		sort.Strings(subl)
-		for _, c := range subl {
-			fmt.Fprintf(w, "\t%s", c)
-			if desc := ccmds[c].Description; desc != "" {
+	for _, cat := range categorize(subs) {
+		fmt.Fprintf(w, "\n%s:\n", cat.title)
+		for _, sub := range cat.cmds {
+			fmt.Fprintf(w, "\t%s", sub.Name)
+			if desc := sub.Command.Description; desc != "" {
 				fmt.Fprintf(w, "\t%s", desc)
 			}
+			if sub.Name == c.DefaultSubcommand {
+				fmt.Fprint(w, " (default)")
+			}
+			if sub.Command.Deprecated != nil {
+				fmt.Fprint(w, " (deprecated)")
+			}
 			fmt.Fprintln(w)
 		}
 	}
 }
 
+type optionGroup struct {
+	title string
+	opts  []NamedOption
+}
+
+// groupOptions splits opts, which include help, into sections for the help message. Ungrouped options go
+// under OPTIONS and each group gets its own section, in order of first appearance.
+// When no groups are used, help goes under OPTIONS as well, otherwise it goes into
+// the GENERAL section, which comes last unless an option has already declared it.
+func groupOptions(opts []NamedOption) []optionGroup {
+	var (
+		ungrouped []NamedOption
+		help      NamedOption
+		groups    []optionGroup
+		index     = make(map[string]int)
+	)
+	for _, o := range opts {
+		if o.Name == "help" {
+			help = o
+			continue
+		}
+		name := optionDetails(o.Option).Group
+		if name == "" {
+			ungrouped = append(ungrouped, o)
+			continue
+		}
+		title := strings.ToUpper(name)
+		i, ok := index[title]
+		if !ok {
+			i = len(groups)
+			index[title] = i
+			groups = append(groups, optionGroup{title: title})
+		}
+		groups[i].opts = append(groups[i].opts, o)
+	}
+	if len(groups) == 0 {
+		// This is always printed, since help option is always present.
+		return []optionGroup{{title: "OPTIONS", opts: opts}}
+	}
+	if i, ok := index["GENERAL"]; ok {
+		groups[i].opts = append(groups[i].opts, help)
+	} else {
+		groups = append(groups, optionGroup{title: "GENERAL", opts: []NamedOption{help}})
+	}
+	if len(ungrouped) > 0 {
+		groups = append([]optionGroup{{title: "OPTIONS", opts: ungrouped}}, groups...)
+	}
+	return groups
+}
+
+type commandCategory struct {
+	title string
+	cmds  []NamedCommand
+}
+
+// categorize splits subs into sections for the help message. Commands without a category
+// go under COMMANDS and each category gets its own section, in order of first appearance.
+func categorize(subs []NamedCommand) []commandCategory {
+	var (
+		cats  = []commandCategory{{title: "COMMANDS"}}
+		index = make(map[string]int)
+	)
+	for _, sub := range subs {
+		title := strings.ToUpper(sub.Command.Category)
+		if title == "" {
+			cats[0].cmds = append(cats[0].cmds, sub)
+			continue
+		}
+		i, ok := index[title]
+		if !ok {
+			i = len(cats)
+			index[title] = i
+			cats = append(cats, commandCategory{title: title})
+		}
+		cats[i].cmds = append(cats[i].cmds, sub)
+	}
+	if len(cats[0].cmds) == 0 {
+		cats = cats[1:]
+	}
+	return cats
+}
+
 // Program carries information about a running command.
 type Program interface {
+	// Name returns the program's name.
 	Name() string
+	// Path returns the full path of the running command, starting with the program's name,
+	// e.g. ["tool", "remote", "add"].
+	Path() []string
+	// RawArgs returns the raw argument vector, starting with the program's executable.
+	RawArgs() []string
+	// Args returns the remaining positional arguments, that is, the ones not consumed by
+	// the running command's Arg.
+	Args() []string
+	Stdin() io.Reader
 	Stdout() io.Writer
 	Stderr() io.Writer
+	// Flush writes buffered output to the real stdout and stderr.
+	Flush() error
+	// Getenv, LookupEnv and Environ work just like their counterparts from package os,
+	// but for the program's environment.
+	Getenv(key string) string
+	LookupEnv(key string) (string, bool)
+	Environ() []string
+	// Dir returns the program's working directory.
+	Dir() string
 }
 
 func wrapWrite(w io.Writer, line string) {
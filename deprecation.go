@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+// Deprecation marks a command or an option as deprecated.
+//
+// Deprecated commands and options keep working, but a warning is printed to stderr
+// every run they are used. When Cutoff is set and the CLI has strict deprecations
+// enabled, using them after the cutoff is treated as a misuse of the command line.
+type Deprecation struct {
+	Message string    // Message usually tells what to use instead, e.g. "use -output instead".
+	Cutoff  time.Time // Cutoff is when the command or option stops being supported.
+}
+
+func (d *Deprecation) describe(what, state string) string {
+	if d.Message == "" {
+		return fmt.Sprintf("%s %s", what, state)
+	}
+	return fmt.Sprintf("%s %s: %s", what, state, d.Message)
+}
+
+// check warns about what being used, or returns an error when it is used after
+// the cutoff and strict is set.
+func (d *Deprecation) check(prg *program, what string, strict bool) error {
+	if strict && !d.Cutoff.IsZero() && time.Now().After(d.Cutoff) {
+		return fmt.Errorf("%s", d.describe(what, "is no longer supported"))
+	}
+	fmt.Fprintf(prg.stderr, "%s: warning: %s\n", prg.name, d.describe(what, "is deprecated"))
+	return nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrMisuse is matched by every UsageError when using errors.Is.
+	ErrMisuse = errors.New("cli: command-line misuse")
+	// ErrHelp is wrapped by every HelpError.
+	ErrHelp = errors.New("cli: help requested")
+)
+
+// UsageError is returned by Run when the command line is misused,
+// for example, when a required argument is missing.
+type UsageError struct {
+	Path []string // Path is the full path of the misused command.
+	Err  error    // Err describes what is wrong with the command line.
+
+	usage func(io.Writer)
+}
+
+func (e *UsageError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *UsageError) Unwrap() error { return e.Err }
+
+// Is reports whether target is ErrMisuse.
+func (e *UsageError) Is(target error) bool { return target == ErrMisuse }
+
+// WriteUsage writes usage instructions of the misused command to w.
+func (e *UsageError) WriteUsage(w io.Writer) { e.usage(w) }
+
+// UnknownCommandError is wrapped by a UsageError when a subcommand is not defined.
+type UnknownCommandError struct {
+	Name string // Name is the name of the unknown subcommand.
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("command provided but not defined: %s", e.Name)
+}
+
+// HelpError is returned by Run when help is requested, either explicitly by the
+// help option or implicitly by running a command that has no Exec function.
+type HelpError struct {
+	Path []string // Path is the full path of the command whose help is requested.
+
+	usage func(io.Writer)
+}
+
+func (e *HelpError) Error() string { return ErrHelp.Error() }
+
+// Unwrap returns ErrHelp.
+func (e *HelpError) Unwrap() error { return ErrHelp }
+
+// WriteUsage writes usage instructions of the command to w.
+func (e *HelpError) WriteUsage(w io.Writer) { e.usage(w) }
+
+// ExecError is returned by Run when a command's Exec function returns an error.
+type ExecError struct {
+	Path []string // Path is the full path of the command that failed.
+	Err  error    // Err is the error returned by the command.
+}
+
+func (e *ExecError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *ExecError) Unwrap() error { return e.Err }
+
+// ValidationError is returned by Command.Validate with every problem found in a command tree.
+type ValidationError struct {
+	Problems []string // Problems describe each mistake, prefixed by the command it was found in.
+}
+
+func (e *ValidationError) Error() string {
+	return "cli: invalid command tree:\n\t" + strings.Join(e.Problems, "\n\t")
+}
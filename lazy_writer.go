@@ -1,8 +1,8 @@
 package cli
 
 import (
-	"fmt"
 	"io"
+	"sync"
 )
 
 type writemeta struct {
@@ -10,29 +10,47 @@ type writemeta struct {
 	txt string
 }
 
+// lazyWriter buffers writes to stdout and stderr, preserving their order,
+// until it is flushed. When streaming, it writes straight through instead.
+// It is safe for concurrent use, and whole writes never get interleaved.
 type lazyWriter struct {
+	mu             sync.Mutex
 	stdout, stderr io.Writer
 	input          []writemeta
+	stream         bool
 }
 
-func (lw *lazyWriter) flush() {
-	for _, line := range lw.input {
-		fmt.Fprint(line.w, line.txt)
+func (lw *lazyWriter) flush() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for i, line := range lw.input {
+		if _, err := io.WriteString(line.w, line.txt); err != nil {
+			lw.input = lw.input[i+1:]
+			return err
+		}
 	}
+	lw.input = nil
+	return nil
+}
+
+func (lw *lazyWriter) write(w io.Writer, b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.stream {
+		return w.Write(b)
+	}
+	lw.input = append(lw.input, writemeta{w, string(b)})
+	return len(b), nil
 }
 
 type stdoutWriter lazyWriter
 
 func (w *stdoutWriter) Write(b []byte) (int, error) {
-	l := writemeta{w.stdout, string(b)}
-	w.input = append(w.input, l)
-	return len(b), nil
+	return (*lazyWriter)(w).write(w.stdout, b)
 }
 
 type stderrWriter lazyWriter
 
 func (w *stderrWriter) Write(b []byte) (int, error) {
-	l := writemeta{w.stderr, string(b)}
-	w.input = append(w.input, l)
-	return len(b), nil
+	return (*lazyWriter)(w).write(w.stderr, b)
 }
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"strconv"
+	"unicode"
 )
 
 // Option is a type that is able to define its flags to a flag set
@@ -14,50 +16,158 @@ type Option interface {
 }
 
 // OptionDetails are common fields for an option, which are its details.
+//
+// Short is an optional single-character name, which can be any printable Unicode
+// character other than '-' and '='. Defining an option whose short name is either
+// invalid or already defined panics.
+//
+// Aliases are extra long names for the option, which share its recipient.
+//
+// When Env is set and the environment variable it names is set as well,
+// the variable's value overrides the option's default value.
+//
+// When Group is set, the option is listed in the help message under its own
+// section, titled after the group, instead of the default OPTIONS section.
+//
+// When Hidden is set, the option is not listed in the help message, but it can still be used.
+//
+// When Deprecated is set, the option is marked as deprecated in the help message
+// and a warning is printed to stderr when it is used.
 type OptionDetails struct {
 	Description string
-	Short       byte
+	Short       rune
+	Aliases     []string
 	ArgLabel    string
+	Env         string
+	Group       string
+	Hidden      bool
+	Deprecated  *Deprecation
 }
 
 // WriteDoc writes to w a flag's description in a pretty way.
 func (ff OptionDetails) WriteDoc(w io.Writer, name string) {
+	ff.writeDoc(w, name)
+}
+
+// writeDoc writes to w a flag's description followed by notes about it,
+// which are separated by spaces.
+func (ff OptionDetails) writeDoc(w io.Writer, name string, notes ...string) {
 	if ff.Short == 0 {
 		fmt.Fprint(w, "    ")
 	} else {
-		fmt.Fprintf(w, "-%s, ", string(ff.Short))
+		fmt.Fprintf(w, "-%c, ", ff.Short)
 	}
 	fmt.Fprintf(w, "-%s", name)
+	for _, alias := range ff.Aliases {
+		fmt.Fprintf(w, ", -%s", alias)
+	}
 	if ff.ArgLabel != "" {
 		fmt.Fprintf(w, " <%s>", ff.ArgLabel)
 	}
+	var marks []string
+	if ff.Env != "" {
+		marks = append(marks, fmt.Sprintf("(env: %s)", ff.Env))
+	}
+	if ff.Deprecated != nil {
+		marks = append(marks, "(deprecated)")
+	}
+	notes = append(marks, notes...)
 	fmt.Fprintf(w, "\t%s", ff.Description)
+	for i, note := range notes {
+		if i > 0 || ff.Description != "" {
+			fmt.Fprint(w, " ")
+		}
+		fmt.Fprint(w, note)
+	}
 }
 
-func (ff OptionDetails) defineShort(f *flag.FlagSet, name string) {
-	if ff.Short == 0 {
-		return
+func (ff OptionDetails) details() OptionDetails { return ff }
+
+// optionDetails returns o's details when it embeds OptionDetails.
+func optionDetails(o Option) OptionDetails {
+	if d, ok := o.(interface{ details() OptionDetails }); ok {
+		return d.details()
 	}
+	return OptionDetails{}
+}
+
+// defineAliases defines the option's short name and long aliases as flags
+// sharing the value of the flag already defined as name.
+func (ff OptionDetails) defineAliases(f *flag.FlagSet, name string) {
 	fg := f.Lookup(name)
 	if fg == nil {
 		return
 	}
-	f.Var(fg.Value, string(ff.Short), ff.Description)
+	if ff.Short != 0 {
+		short := string(ff.Short)
+		if !validShort(ff.Short) {
+			panic(fmt.Errorf("cli: invalid short name %q for option -%s", short, name))
+		}
+		if f.Lookup(short) != nil {
+			panic(fmt.Errorf("cli: short name %q of option -%s is already defined", short, name))
+		}
+		f.Var(fg.Value, short, ff.Description)
+	}
+	for _, alias := range ff.Aliases {
+		f.Var(fg.Value, alias, ff.Description)
+	}
+}
+
+// validShort reports whether r can be used as a short name.
+func validShort(r rune) bool {
+	return unicode.IsPrint(r) && !unicode.IsSpace(r) && r != '-' && r != '='
 }
 
 // BoolOption represents a boolean flag.
+//
+// When Negatable is set, a "no-" prefixed flag is defined as well, which sets the
+// recipient to false, e.g. -no-color for -color. Using both is a misuse.
 type BoolOption struct {
 	OptionDetails
 	DefValue  bool
+	Negatable bool
 	Recipient *bool
 }
 
 // Define implements Option by defining a boolean flag to f.
 func (fg BoolOption) Define(f *flag.FlagSet, name string) {
 	f.BoolVar(fg.Recipient, name, fg.DefValue, fg.Description)
-	fg.defineShort(f, name)
+	fg.defineAliases(f, name)
+	if fg.Negatable {
+		f.Var((*negatedBool)(fg.Recipient), "no-"+name, fg.Description)
+	}
+}
+
+// WriteDoc implements Option by writing the flag's description to w,
+// including its negated form when it is negatable.
+func (fg BoolOption) WriteDoc(w io.Writer, name string) {
+	if fg.Negatable {
+		fg.Aliases = append(fg.Aliases[:len(fg.Aliases):len(fg.Aliases)], "no-"+name)
+	}
+	fg.OptionDetails.WriteDoc(w, name)
+}
+
+// negatedBool is a boolean flag value that stores the opposite of what is set.
+type negatedBool bool
+
+func (b *negatedBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b = negatedBool(!v)
+	return nil
+}
+
+func (b *negatedBool) String() string {
+	if b == nil {
+		return "true"
+	}
+	return strconv.FormatBool(!bool(*b))
 }
 
+func (b *negatedBool) IsBoolFlag() bool { return true }
+
 // StringOption represents a string flag.
 type StringOption struct {
 	OptionDetails
@@ -68,17 +178,17 @@ type StringOption struct {
 // Define implements Option by defining a string flag to f.
 func (fg StringOption) Define(f *flag.FlagSet, name string) {
 	f.StringVar(fg.Recipient, name, fg.DefValue, fg.Description)
-	fg.defineShort(f, name)
+	fg.defineAliases(f, name)
 }
 
 // WriteDoc writes the standard flag documentation and also the default
 // value when it's not an empty string to w.
 func (fg StringOption) WriteDoc(w io.Writer, name string) {
-	fg.OptionDetails.WriteDoc(w, name)
 	if fg.DefValue == "" {
+		fg.writeDoc(w, name)
 		return
 	}
-	fmt.Fprintf(w, " (default: %q)", fg.DefValue)
+	fg.writeDoc(w, name, fmt.Sprintf("(default: %q)", fg.DefValue))
 }
 
 // IntOption represents an integer flag.
@@ -91,7 +201,7 @@ type IntOption struct {
 // Define implements Option by defining an integer flag to f.
 func (fg IntOption) Define(f *flag.FlagSet, name string) {
 	f.IntVar(fg.Recipient, name, fg.DefValue, fg.Description)
-	fg.defineShort(f, name)
+	fg.defineAliases(f, name)
 }
 
 // Int64Option represents a 64-bit integer flag.
@@ -104,9 +214,84 @@ type Int64Option struct {
 // Define implements Option by defining a 64-bit integer flag to f.
 func (fg Int64Option) Define(f *flag.FlagSet, name string) {
 	f.Int64Var(fg.Recipient, name, fg.DefValue, fg.Description)
-	fg.defineShort(f, name)
+	fg.defineAliases(f, name)
+}
+
+// CountOption represents a flag that counts how many times it is used,
+// e.g. "-v -v -v" sets its recipient to 3. It can also be set to a number,
+// e.g. "-v=3". When Max is set, using it more than Max times is a misuse.
+type CountOption struct {
+	OptionDetails
+	DefValue  int
+	Max       int
+	Recipient *int
+}
+
+// Define implements Option by defining a counting flag to f.
+func (fg CountOption) Define(f *flag.FlagSet, name string) {
+	*fg.Recipient = fg.DefValue
+	f.Var(&counter{n: fg.Recipient}, name, fg.Description)
+	fg.defineAliases(f, name)
+}
+
+// WriteDoc writes the standard flag documentation and also
+// a note about the flag being repeatable to w.
+func (fg CountOption) WriteDoc(w io.Writer, name string) {
+	if fg.Max > 0 {
+		fg.writeDoc(w, name, fmt.Sprintf("(repeatable, at most %d times)", fg.Max))
+		return
+	}
+	fg.writeDoc(w, name, "(repeatable)")
 }
 
+// counter is a boolean flag value that increments on every use.
+//
+// Since the flag package reports errors of boolean flags as invalid boolean values,
+// bad values are not returned by Set, but kept in order to be checked after parsing.
+type counter struct {
+	n        *int
+	explicit bool   // explicit reports whether the count was set to a number.
+	bad      string // bad is the last value that is not a number.
+}
+
+func (c *counter) Set(s string) error {
+	// A bare flag, like "-v", is set to "true" by the flag package.
+	if s == "true" {
+		*c.n++
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		c.bad = s
+		return nil
+	}
+	*c.n = n
+	c.explicit = true
+	return nil
+}
+
+// check returns an error when the counter was set to a bad value or when it exceeds limit.
+func (c *counter) check(name string, limit int) error {
+	switch {
+	case c.bad != "":
+		return fmt.Errorf("invalid count %q for -%s: want a non-negative number", c.bad, name)
+	case limit <= 0 || *c.n <= limit:
+		return nil
+	case c.explicit:
+		return fmt.Errorf("value of -%s exceeds maximum: want at most %d, got %d", name, limit, *c.n)
+	}
+	return fmt.Errorf("too many occurrences of -%s: want at most %d, got %d", name, limit, *c.n)
+}
+
+func (c *counter) String() string {
+	if c == nil || c.n == nil {
+		return "0"
+	}
+	return strconv.Itoa(*c.n)
+}
+
+func (c *counter) IsBoolFlag() bool { return true }
+
 // VarOption represents a flag that implements flag.Value.
 type VarOption struct {
 	OptionDetails
@@ -116,5 +301,5 @@ type VarOption struct {
 // Define implements Option by defining a flag that implements flag.Value to f.
 func (fg VarOption) Define(f *flag.FlagSet, name string) {
 	f.Var(fg.Recipient, name, fg.Description)
-	fg.defineShort(f, name)
+	fg.defineAliases(f, name)
 }
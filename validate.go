@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Validate walks the command tree starting at c and reports every definition mistake
+// it finds at once, as a *ValidationError, or nil when there is none. Mistakes are,
+// for example, options sharing names, options clashing with the help option, an Arg
+// that is ignored because of subcommands, a required argument after an optional one,
+// or a subcommand that is also one of its ancestors.
+//
+// It is meant to be called from unit tests, but it can also be enforced by
+// creating a CLI with the Validate option.
+func (c *Command) Validate() error {
+	v := validator{ancestors: make(map[*Command]bool)}
+	v.command(nil, c)
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type validator struct {
+	problems  []string
+	ancestors map[*Command]bool // ancestors are the commands being validated up the tree.
+}
+
+func (v *validator) report(path []string, format string, args ...interface{}) {
+	where := "root command"
+	if len(path) > 0 {
+		where = fmt.Sprintf("command %q", strings.Join(path, " "))
+	}
+	v.problems = append(v.problems, where+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) command(path []string, c *Command) {
+	v.ancestors[c] = true
+	defer delete(v.ancestors, c)
+	v.options(path, c)
+	v.args(path, c)
+	names := make(map[string]bool)
+	for _, sub := range c.subcommands() {
+		switch {
+		case !validName(sub.Name):
+			v.report(path, "invalid command name %q", sub.Name)
+		case names[sub.Name]:
+			v.report(path, "command %q is declared more than once", sub.Name)
+		}
+		names[sub.Name] = true
+		if sub.Command == nil {
+			v.report(path, "command %q is nil", sub.Name)
+			continue
+		}
+		if v.ancestors[sub.Command] {
+			v.report(path, "command %q creates a cycle, since it is also one of its ancestors", sub.Name)
+			continue
+		}
+		v.command(append(path[:len(path):len(path)], sub.Name), sub.Command)
+	}
+	if def := c.DefaultSubcommand; def != "" && !names[def] {
+		v.report(path, "default command %q is not defined", def)
+	}
+}
+
+func (v *validator) options(path []string, c *Command) {
+	// owners maps every flag name to the option that defines it.
+	owners := map[string]string{"help": "help", "h": "help"}
+	claim := func(name, owner string) {
+		switch prev, ok := owners[name]; {
+		case !ok:
+			owners[name] = owner
+		case prev == "help":
+			v.report(path, "option -%s: name %q clashes with the help option", owner, name)
+		case prev == owner:
+			v.report(path, "option -%s: name %q is used more than once", owner, name)
+		default:
+			v.report(path, "option -%s: name %q is already used by option -%s", owner, name, prev)
+		}
+	}
+	declared := make(map[string]bool)
+	for _, o := range c.options() {
+		if declared[o.Name] {
+			v.report(path, "option -%s is declared more than once", o.Name)
+			continue
+		}
+		declared[o.Name] = true
+		if o.Option == nil {
+			v.report(path, "option -%s is nil", o.Name)
+			continue
+		}
+		if !validName(o.Name) {
+			v.report(path, "invalid option name %q", o.Name)
+		}
+		claim(o.Name, o.Name)
+		details := optionDetails(o.Option)
+		if details.Short != 0 {
+			if validShort(details.Short) {
+				claim(string(details.Short), o.Name)
+			} else {
+				v.report(path, "option -%s: invalid short name %q", o.Name, details.Short)
+			}
+		}
+		for _, alias := range details.Aliases {
+			if !validName(alias) {
+				v.report(path, "option -%s: invalid alias %q", o.Name, alias)
+			}
+			claim(alias, o.Name)
+		}
+		switch opt := o.Option.(type) {
+		case BoolOption:
+			if opt.Negatable {
+				claim("no-"+o.Name, o.Name)
+			}
+		case CountOption:
+			if opt.Max < 0 {
+				v.report(path, "option -%s: negative maximum %d", o.Name, opt.Max)
+			}
+		}
+	}
+}
+
+func (v *validator) args(path []string, c *Command) {
+	if c.Arg == nil {
+		return
+	}
+	if !c.takesArg() {
+		v.report(path, "Arg is ignored since the command has subcommands but no Exec")
+	}
+	var (
+		list     ArgList
+		optional string
+	)
+	c.Arg.AppendTo(&list)
+	for i, arg := range list.args {
+		if arg.required && optional != "" {
+			v.report(path, "required argument %s follows optional argument %s", arg.name, optional)
+		}
+		if !arg.required && optional == "" {
+			optional = arg.name
+		}
+		if !arg.repeat {
+			continue
+		}
+		if i < len(list.args)-1 {
+			v.report(path, "repeating argument %s is not the last one", arg.name)
+		}
+		if arg.min < 0 || arg.max < 0 {
+			v.report(path, "argument %s: negative bounds {%d,%d}", arg.name, arg.min, arg.max)
+		} else if arg.max > 0 && arg.max < arg.min {
+			v.report(path, "argument %s: maximum %d is less than minimum %d", arg.name, arg.max, arg.min)
+		}
+	}
+}
+
+// validName reports whether s can be used as an option or command name.
+func validName(s string) bool {
+	if s == "" || s[0] == '-' {
+		return false
+	}
+	return !strings.Contains(s, "=") && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsPrint(r) || unicode.IsSpace(r)
+	}) < 0
+}
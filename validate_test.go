@@ -0,0 +1,190 @@
+package cli_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gbrlsnchs/cli"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		entry *cli.Command
+		want  []string
+	}{
+		{
+			desc: "valid",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"color": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Short: 'c', Aliases: []string{"colour"}},
+						Negatable:     true,
+						Recipient:     new(bool),
+					},
+				},
+				Subcommands: map[string]*cli.Command{
+					"add": {
+						Arg: cli.StringArg{
+							Label:     "NAME",
+							Required:  true,
+							Recipient: new(string),
+							Next: cli.RepeatingArg{
+								Label:     "REST",
+								Max:       2,
+								Recipient: new([]string),
+							},
+						},
+					},
+				},
+			},
+			want: nil,
+		},
+		{
+			desc: "options",
+			entry: &cli.Command{
+				Options: map[string]cli.Option{
+					"help": cli.BoolOption{Recipient: new(bool)},
+					"hard": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Short: 'h'},
+						Recipient:     new(bool),
+					},
+					"all": cli.BoolOption{Recipient: new(bool)},
+					"any": cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Short: 'a', Aliases: []string{"all"}},
+						Recipient:     new(bool),
+					},
+					"bad=name": cli.StringOption{Recipient: new(string)},
+					"color": cli.BoolOption{
+						Negatable: true,
+						Recipient: new(bool),
+					},
+					"no-color": cli.BoolOption{Recipient: new(bool)},
+					"verbose": cli.CountOption{
+						OptionDetails: cli.OptionDetails{Short: ' '},
+						Max:           -1,
+						Recipient:     new(int),
+					},
+				},
+				OrderedOptions: []cli.NamedOption{
+					{"all", cli.BoolOption{
+						OptionDetails: cli.OptionDetails{Short: 'a'},
+						Recipient:     new(bool),
+					}},
+				},
+			},
+			want: []string{
+				`root command: option -all is declared more than once`,
+				`root command: option -any: name "a" is already used by option -all`,
+				`root command: option -any: name "all" is already used by option -all`,
+				`root command: invalid option name "bad=name"`,
+				`root command: option -hard: name "h" clashes with the help option`,
+				`root command: option -help: name "help" clashes with the help option`,
+				`root command: option -no-color: name "no-color" is already used by option -color`,
+				`root command: option -verbose: invalid short name ' '`,
+				`root command: option -verbose: negative maximum -1`,
+			},
+		},
+		{
+			desc: "commands and arguments",
+			entry: &cli.Command{
+				Arg:               cli.StringArg{Label: "IGNORED", Recipient: new(string)},
+				DefaultSubcommand: "missing",
+				Subcommands: map[string]*cli.Command{
+					"remote": {
+						OrderedSubcommands: []cli.NamedCommand{
+							{"add", &cli.Command{
+								Arg: cli.StringArg{
+									Label:     "NAME",
+									Recipient: new(string),
+									Next: cli.StringArg{
+										Label:     "URL",
+										Required:  true,
+										Recipient: new(string),
+									},
+								},
+							}},
+							{"-rm", &cli.Command{}},
+							{"nil", nil},
+						},
+						Subcommands: map[string]*cli.Command{
+							"add": {},
+							"list": {
+								Arg: cli.RepeatingArg{
+									Label:     "REMOTE",
+									Min:       3,
+									Max:       2,
+									Recipient: new([]string),
+								},
+							},
+						},
+					},
+				},
+			},
+			want: []string{
+				`root command: Arg is ignored since the command has subcommands but no Exec`,
+				`command "remote add": required argument URL follows optional argument NAME`,
+				`command "remote": invalid command name "-rm"`,
+				`command "remote": command "nil" is nil`,
+				`command "remote": command "add" is declared more than once`,
+				`command "remote list": argument REMOTE: maximum 2 is less than minimum 3`,
+				`root command: default command "missing" is not defined`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.entry.Validate()
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("want nil, got %v", err)
+				}
+				return
+			}
+			var verr *cli.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("want %T, got %T", verr, err)
+			}
+			if want, got := tc.want, verr.Problems; !cmp.Equal(got, want) {
+				t.Fatalf("problems mismatch (-want +got):\n%s", cmp.Diff(want, got))
+			}
+		})
+	}
+	t.Run("cycle", func(t *testing.T) {
+		root := &cli.Command{}
+		remote := &cli.Command{
+			Subcommands: map[string]*cli.Command{"root": root},
+		}
+		shared := &cli.Command{}
+		root.Subcommands = map[string]*cli.Command{
+			"remote": remote,
+			"a":      shared,
+			"b":      shared,
+		}
+		var verr *cli.ValidationError
+		if err := root.Validate(); !errors.As(err, &verr) {
+			t.Fatalf("want %T, got %T", verr, err)
+		}
+		want := []string{`command "remote": command "root" creates a cycle, since it is also one of its ancestors`}
+		if got := verr.Problems; !cmp.Equal(got, want) {
+			t.Fatalf("problems mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	})
+	t.Run("option", func(t *testing.T) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("want panic, got none")
+			}
+			err, ok := r.(error)
+			var verr *cli.ValidationError
+			if !ok || !errors.As(err, &verr) {
+				t.Fatalf("want panic with %T, got %v", verr, r)
+			}
+		}()
+		cli.New(&cli.Command{
+			Options: map[string]cli.Option{"help": cli.BoolOption{Recipient: new(bool)}},
+		}, cli.Validate(true))
+	})
+}